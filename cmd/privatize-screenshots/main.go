@@ -0,0 +1,100 @@
+package main
+
+import (
+	"Insightify-backend/internal/blobstore"
+	"Insightify-backend/internal/database"
+	"Insightify-backend/internal/services"
+	"context"
+	"flag"
+	"log"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	_ "github.com/joho/godotenv/autoload"
+)
+
+const batchSize = 500
+
+// privatize-screenshots is run once after upgrading to private screenshots.
+// Screenshots stored before then have a public URL and, on Cloud Storage, an
+// object anyone can read. It removes the public access, backfills the object
+// name of rows that lack one and clears the public URL.
+func main() {
+	publicURL := flag.String("public-url", "https://storage.googleapis.com/"+os.Getenv("FIREBASE_STORAGE_BUCKET"),
+		"address the public URLs of screenshots start with, such as the former S3_PUBLIC_URL")
+	dryRun := flag.Bool("dry-run", false, "only log what would be changed")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	analyses := services.NewAnalysisService(database.New().DB())
+	blobs, err := blobstore.New(ctx)
+	if err != nil {
+		log.Fatalf("error creating blob store: %v", err)
+	}
+	remover, canRemove := blobs.(blobstore.PublicAccessRemover)
+	if !canRemove {
+		log.Println("The blob store has no per object access rules, make sure its bucket does not allow public reads")
+	}
+
+	var afterID uint
+	var migrated, skipped int
+	for {
+		screenshots, err := analyses.PublicScreenshots(ctx, afterID, batchSize)
+		if err != nil {
+			log.Fatalf("error listing public screenshots: %v", err)
+		}
+		if len(screenshots) == 0 {
+			break
+		}
+
+		for i := range screenshots {
+			screenshot := &screenshots[i]
+			afterID = screenshot.ID
+
+			objectName := screenshot.ObjectName
+			if objectName == "" {
+				objectName = objectNameFromURL(screenshot.URL, *publicURL)
+			}
+			if objectName == "" {
+				log.Printf("Screenshot %d: %s is not under %s, skipping", screenshot.ID, screenshot.URL, *publicURL)
+				skipped++
+				continue
+			}
+			if *dryRun {
+				log.Printf("Screenshot %d: would make %s private", screenshot.ID, objectName)
+				migrated++
+				continue
+			}
+
+			if canRemove {
+				if err := remover.MakePrivate(ctx, objectName); err != nil {
+					log.Fatalf("error making %s private: %v", objectName, err)
+				}
+			}
+			if err := analyses.MakeScreenshotPrivate(ctx, screenshot, objectName); err != nil {
+				log.Fatalf("error updating screenshot %d: %v", screenshot.ID, err)
+			}
+			migrated++
+		}
+	}
+	log.Printf("Made %d screenshots private, skipped %d", migrated, skipped)
+}
+
+// objectNameFromURL returns the key of the object a public URL points at, or
+// an empty string when the URL is not under publicURL
+func objectNameFromURL(rawURL string, publicURL string) string {
+	prefix := strings.TrimSuffix(publicURL, "/") + "/"
+	if !strings.HasPrefix(rawURL, prefix) {
+		return ""
+	}
+	objectName, err := url.PathUnescape(strings.TrimPrefix(rawURL, prefix))
+	if err != nil {
+		return ""
+	}
+	return objectName
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"Insightify-backend/internal/analyze"
+	"Insightify-backend/internal/blobstore"
+	"Insightify-backend/internal/browser"
+	"Insightify-backend/internal/database"
+	"Insightify-backend/internal/jobs"
+	"Insightify-backend/internal/progress"
+	"Insightify-backend/internal/retention"
+	"Insightify-backend/internal/services"
+	"Insightify-backend/internal/utils"
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	_ "github.com/joho/godotenv/autoload"
+)
+
+const (
+	defaultConcurrency = 2
+	statsInterval      = time.Minute
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	concurrency := defaultConcurrency
+	if value := os.Getenv("WORKER_CONCURRENCY"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			log.Fatalf("invalid WORKER_CONCURRENCY: %s", value)
+		}
+		concurrency = parsed
+	}
+
+	redisClient := utils.NewRedisClient(ctx)
+	if redisClient == nil {
+		log.Fatal("REDIS_URL environment variable is not set")
+	}
+	defer redisClient.Close()
+
+	dbService := database.New()
+	analysisService := services.NewAnalysisService(dbService.DB())
+	// One warm browser per consumer unless BROWSER_POOL_SIZE says otherwise
+	browsers := browser.NewPool(browser.ConfigFromEnv(concurrency))
+	defer browsers.Close()
+	go logBrowserStats(ctx, browsers)
+
+	blobs, err := blobstore.New(ctx)
+	if err != nil {
+		log.Fatalf("error creating blob store: %v", err)
+	}
+
+	// Workers also remove screenshots past their plan's retention
+	go retention.NewSweeper(analysisService, blobs, retention.ConfigFromEnv()).Run(ctx)
+
+	runner := analyze.NewJobRunner(analysisService, progress.NewRedisPublisher(redisClient), jobs.NewRedisCanceller(redisClient), browsers, blobs)
+
+	worker := jobs.NewWorker(jobs.NewQueue(redisClient), concurrency, runner.Run)
+	if err := worker.Run(ctx); err != nil {
+		log.Fatalf("worker stopped: %v", err)
+	}
+	log.Println("Worker shut down")
+}
+
+func logBrowserStats(ctx context.Context, browsers *browser.Pool) {
+	ticker := time.NewTicker(statsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			stats := browsers.Stats()
+			log.Printf("Browser pool: %d/%d running, %d in use, %d jobs, %d started, %d recycled, %d crashed",
+				stats.Running, stats.Size, stats.InUse, stats.Jobs, stats.Started, stats.Recycled, stats.Crashed)
+		}
+	}
+}
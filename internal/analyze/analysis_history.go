@@ -0,0 +1,402 @@
+package analyze
+
+import (
+	"Insightify-backend/internal/blobstore"
+	"Insightify-backend/internal/database/models"
+	"Insightify-backend/internal/services"
+	tokenvalidation "Insightify-backend/internal/validateToken"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+type screenshotResponse struct {
+	ID       uint   `json:"id"`
+	Position int    `json:"position"`
+	Device   string `json:"device"`
+	OffsetY  int    `json:"offsetY"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	Format   string `json:"format"`
+	Bytes    int    `json:"bytes"`
+	URL      string `json:"url"`
+	// Elements are the elements shown in the screenshot with their boxes in screenshot pixels
+	Elements []elementResponse `json:"elements"`
+	// HiddenElements are the fixed and sticky elements left out because an earlier screenshot shows them
+	HiddenElements []models.HiddenElement `json:"hiddenElements"`
+	// Step is the scripted step the screenshot was taken at, empty for captures of the whole page
+	Step string `json:"step,omitempty"`
+}
+
+type elementResponse struct {
+	Tag         string              `json:"tag"`
+	BoundingBox boundingBoxResponse `json:"boundingBox"`
+	HTML        string              `json:"html"`
+}
+
+type insightResponse struct {
+	ID              uint                 `json:"id"`
+	Category        string               `json:"category"`
+	Severity        string               `json:"severity"`
+	Title           string               `json:"title"`
+	Description     string               `json:"description"`
+	ScreenshotIndex int                  `json:"screenshotIndex"`
+	BoundingBox     *boundingBoxResponse `json:"boundingBox"`
+	RecommendedFix  string               `json:"recommendedFix"`
+}
+
+type boundingBoxResponse struct {
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+type analysisResponse struct {
+	ID           uint                  `json:"id"`
+	URL          string                `json:"url"`
+	Status       models.AnalysisStatus `json:"status"`
+	Mode         models.CaptureMode    `json:"mode"`
+	Error        string                `json:"error,omitempty"`
+	Provider     string                `json:"provider"`
+	Model        string                `json:"model"`
+	Summary      string                `json:"summary"`
+	InputTokens  int                   `json:"inputTokens"`
+	OutputTokens int                   `json:"outputTokens"`
+	CreatedAt    time.Time             `json:"createdAt"`
+	UpdatedAt    time.Time             `json:"updatedAt"`
+}
+
+type analysisDetailResponse struct {
+	analysisResponse
+	HTML        string               `json:"html"`
+	Screenshots []screenshotResponse `json:"screenshots"`
+	Insights    []insightResponse    `json:"insights"`
+	// URLsExpireAt is when the signed screenshot URLs stop working, they are renewed through POST /{id}/urls
+	URLsExpireAt time.Time `json:"urlsExpireAt"`
+}
+
+type screenshotURLResponse struct {
+	ID       uint   `json:"id"`
+	Position int    `json:"position"`
+	URL      string `json:"url"`
+}
+
+type screenshotURLsResponse struct {
+	Screenshots []screenshotURLResponse `json:"screenshots"`
+	ExpiresAt   time.Time               `json:"expiresAt"`
+}
+
+type analysisListResponse struct {
+	Analyses []analysisResponse `json:"analyses"`
+	Total    int64              `json:"total"`
+	Page     int                `json:"page"`
+	PageSize int                `json:"pageSize"`
+}
+
+// ListAnalysesHandler returns the caller's analyses, newest first. Supported query
+// parameters are page, pageSize, url (substring match), status, from and to
+// (RFC 3339 or YYYY-MM-DD).
+func (h *AnalysisHandler) ListAnalysesHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	filter := services.AnalysisFilter{
+		URL:      query.Get("url"),
+		Status:   models.AnalysisStatus(query.Get("status")),
+		Page:     1,
+		PageSize: defaultPageSize,
+	}
+
+	if filter.Status != "" && !filter.Status.Valid() {
+		http.Error(w, "Invalid status", http.StatusBadRequest)
+		return
+	}
+	if page := query.Get("page"); page != "" {
+		value, err := strconv.Atoi(page)
+		if err != nil || value < 1 {
+			http.Error(w, "Invalid page", http.StatusBadRequest)
+			return
+		}
+		filter.Page = value
+	}
+	if pageSize := query.Get("pageSize"); pageSize != "" {
+		value, err := strconv.Atoi(pageSize)
+		if err != nil || value < 1 || value > maxPageSize {
+			http.Error(w, "Invalid pageSize", http.StatusBadRequest)
+			return
+		}
+		filter.PageSize = value
+	}
+	if from := query.Get("from"); from != "" {
+		value, err := parseDate(from)
+		if err != nil {
+			http.Error(w, "Invalid from date", http.StatusBadRequest)
+			return
+		}
+		filter.From = &value
+	}
+	if to := query.Get("to"); to != "" {
+		value, err := parseDate(to)
+		if err != nil {
+			http.Error(w, "Invalid to date", http.StatusBadRequest)
+			return
+		}
+		// A bare date includes the whole day
+		if len(to) == len("2006-01-02") {
+			value = value.AddDate(0, 0, 1)
+		}
+		filter.To = &value
+	}
+
+	analyses, total, err := h.analysisService.ListAnalyses(r.Context(), user.ID, filter)
+	if err != nil {
+		log.Printf("Error listing analyses: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	resp := analysisListResponse{
+		Analyses: make([]analysisResponse, 0, len(analyses)),
+		Total:    total,
+		Page:     filter.Page,
+		PageSize: filter.PageSize,
+	}
+	for _, analysis := range analyses {
+		resp.Analyses = append(resp.Analyses, toAnalysisResponse(analysis))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *AnalysisHandler) GetAnalysisHandler(w http.ResponseWriter, r *http.Request) {
+	analysis, ok := h.loadAnalysis(w, r)
+	if !ok {
+		return
+	}
+
+	resp := analysisDetailResponse{
+		analysisResponse: toAnalysisResponse(*analysis),
+		HTML:             analysis.HTML,
+		Screenshots:      make([]screenshotResponse, 0, len(analysis.Screenshots)),
+		Insights:         make([]insightResponse, 0, len(analysis.Insights)),
+		URLsExpireAt:     time.Now().Add(h.urlExpiry),
+	}
+	for _, screenshot := range analysis.Screenshots {
+		url, err := h.screenshotURL(r.Context(), screenshot)
+		if err != nil {
+			log.Printf("Error signing screenshot %d: %v", screenshot.ID, err)
+			http.Error(w, "Failed to sign screenshot URLs", http.StatusBadGateway)
+			return
+		}
+		resp.Screenshots = append(resp.Screenshots, screenshotResponse{
+			ID:             screenshot.ID,
+			Position:       screenshot.Position,
+			Device:         screenshot.Device,
+			OffsetY:        screenshot.OffsetY,
+			Width:          screenshot.Width,
+			Height:         screenshot.Height,
+			Format:         screenshot.Format,
+			Bytes:          screenshot.Bytes,
+			URL:            url,
+			Elements:       toElementResponses(screenshot.Elements),
+			HiddenElements: screenshot.HiddenElements,
+			Step:           screenshot.Step,
+		})
+	}
+	for _, insight := range analysis.Insights {
+		resp.Insights = append(resp.Insights, toInsightResponse(insight))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// SignScreenshotURLsHandler returns freshly signed URLs for the screenshots of
+// the analysis, for clients whose earlier URLs have expired
+func (h *AnalysisHandler) SignScreenshotURLsHandler(w http.ResponseWriter, r *http.Request) {
+	analysis, ok := h.loadAnalysis(w, r)
+	if !ok {
+		return
+	}
+
+	resp := screenshotURLsResponse{
+		Screenshots: make([]screenshotURLResponse, 0, len(analysis.Screenshots)),
+		ExpiresAt:   time.Now().Add(h.urlExpiry),
+	}
+	for _, screenshot := range analysis.Screenshots {
+		url, err := h.screenshotURL(r.Context(), screenshot)
+		if err != nil {
+			log.Printf("Error signing screenshot %d: %v", screenshot.ID, err)
+			http.Error(w, "Failed to sign screenshot URLs", http.StatusBadGateway)
+			return
+		}
+		resp.Screenshots = append(resp.Screenshots, screenshotURLResponse{ID: screenshot.ID, Position: screenshot.Position, URL: url})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// screenshotURL signs a URL for the screenshot. Screenshots stored before
+// objects were private that cmd/privatize-screenshots has not given an object
+// name get an empty URL, so the rest of the analysis can still be shown.
+func (h *AnalysisHandler) screenshotURL(ctx context.Context, screenshot models.Screenshot) (string, error) {
+	if screenshot.ObjectName == "" {
+		log.Printf("Screenshot %d has no object name, leaving out its URL", screenshot.ID)
+		return "", nil
+	}
+	return h.blobs.SignedURL(ctx, screenshot.ObjectName, h.urlExpiry)
+}
+
+// DeleteAnalysisHandler removes the analysis and the stored screenshots no other analysis shares
+func (h *AnalysisHandler) DeleteAnalysisHandler(w http.ResponseWriter, r *http.Request) {
+	analysis, ok := h.loadAnalysis(w, r)
+	if !ok {
+		return
+	}
+	// A queued or running job would keep writing screenshots for the deleted analysis
+	if !analysis.Status.IsFinished() {
+		http.Error(w, "Analysis is still in progress, cancel it first", http.StatusConflict)
+		return
+	}
+
+	objectNames := make([]string, 0, len(analysis.Screenshots))
+	for _, screenshot := range analysis.Screenshots {
+		if screenshot.ObjectName != "" {
+			objectNames = append(objectNames, screenshot.ObjectName)
+		}
+	}
+
+	if err := h.analysisService.DeleteAnalysis(r.Context(), analysis); err != nil {
+		log.Printf("Error deleting analysis %d: %v", analysis.ID, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// The analysis is gone either way, objects left behind are removed by the orphan scan
+	unreferenced, err := h.analysisService.UnreferencedObjects(r.Context(), objectNames)
+	if err == nil {
+		err = blobstore.DeleteAll(r.Context(), h.blobs, unreferenced)
+	}
+	if err != nil {
+		log.Printf("Error deleting screenshots of analysis %d: %v", analysis.ID, err)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// currentUser resolves the authenticated caller, writing an error response when it cannot
+func (h *AnalysisHandler) currentUser(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	claims, ok := tokenvalidation.ClaimsFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	user, err := h.userService.GetOrCreateByProviderID(r.Context(), identityProvider, claims.Subject, claims.Email)
+	if err != nil {
+		log.Printf("Error loading user: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return nil, false
+	}
+	return user, true
+}
+
+// loadAnalysis fetches the analysis named in the URL, scoped to the caller
+func (h *AnalysisHandler) loadAnalysis(w http.ResponseWriter, r *http.Request) (*models.Analysis, bool) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid analysis id", http.StatusBadRequest)
+		return nil, false
+	}
+
+	analysis, err := h.analysisService.GetAnalysis(r.Context(), user.ID, uint(id))
+	if err != nil {
+		log.Printf("Error loading analysis %d: %v", id, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return nil, false
+	}
+	if analysis == nil {
+		http.Error(w, "Analysis not found", http.StatusNotFound)
+		return nil, false
+	}
+	return analysis, true
+}
+
+func toAnalysisResponse(analysis models.Analysis) analysisResponse {
+	return analysisResponse{
+		ID:           analysis.ID,
+		URL:          analysis.URL,
+		Status:       analysis.Status,
+		Mode:         analysis.Mode,
+		Error:        analysis.Error,
+		Provider:     analysis.Provider,
+		Model:        analysis.LLMModel,
+		Summary:      analysis.Summary,
+		InputTokens:  analysis.InputTokens,
+		OutputTokens: analysis.OutputTokens,
+		CreatedAt:    analysis.CreatedAt,
+		UpdatedAt:    analysis.UpdatedAt,
+	}
+}
+
+func toInsightResponse(insight models.Insight) insightResponse {
+	resp := insightResponse{
+		ID:              insight.ID,
+		Category:        insight.Category,
+		Severity:        insight.Severity,
+		Title:           insight.Title,
+		Description:     insight.Description,
+		ScreenshotIndex: insight.ScreenshotIndex,
+		RecommendedFix:  insight.RecommendedFix,
+	}
+	if insight.BoxX != nil && insight.BoxY != nil && insight.BoxWidth != nil && insight.BoxHeight != nil {
+		resp.BoundingBox = &boundingBoxResponse{X: *insight.BoxX, Y: *insight.BoxY, Width: *insight.BoxWidth, Height: *insight.BoxHeight}
+	}
+	return resp
+}
+
+func toElementResponses(elements []models.ScreenshotElement) []elementResponse {
+	resp := make([]elementResponse, 0, len(elements))
+	for _, element := range elements {
+		resp = append(resp, elementResponse{
+			Tag:         element.Tag,
+			BoundingBox: boundingBoxResponse{X: element.X, Y: element.Y, Width: element.Width, Height: element.Height},
+			HTML:        element.HTML,
+		})
+	}
+	return resp
+}
+
+func parseDate(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	jsonResp, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Error handling JSON marshal. Err: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(jsonResp)
+}
@@ -4,8 +4,13 @@ import (
 	"github.com/go-chi/chi/v5"
 )
 
-func AnalysisRoutes() chi.Router {
+func AnalysisRoutes(h *AnalysisHandler) chi.Router {
 	r := chi.NewRouter()
-	r.Get("/ws", WebSocketHandler)
+	r.Get("/ws", h.WebSocketHandler)
+	r.Get("/devices", h.ListDevicesHandler)
+	r.Get("/", h.ListAnalysesHandler)
+	r.Get("/{id}", h.GetAnalysisHandler)
+	r.Delete("/{id}", h.DeleteAnalysisHandler)
+	r.Post("/{id}/urls", h.SignScreenshotURLsHandler)
 	return r
 }
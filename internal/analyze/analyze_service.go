@@ -1,10 +1,24 @@
 package analyze
 
 import (
-	"Insightify-backend/internal/analyze/scraper"
+	"Insightify-backend/internal/analyze/devices"
+	"Insightify-backend/internal/analyze/flow"
+	"Insightify-backend/internal/analyze/imaging"
+	"Insightify-backend/internal/analyze/llm"
+	"Insightify-backend/internal/analyze/session"
+	"Insightify-backend/internal/blobstore"
+	"Insightify-backend/internal/browser"
+	"Insightify-backend/internal/database/models"
+	"Insightify-backend/internal/jobs"
+	"Insightify-backend/internal/progress"
+	"Insightify-backend/internal/services"
+	"context"
 	"encoding/json"
 	"log"
 	"net/http"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
@@ -15,11 +29,105 @@ var upgrader = websocket.Upgrader{
 	CheckOrigin:     func(r *http.Request) bool { return true },
 }
 
+// Command types understood by the WebSocket
+const (
+	CommandCapture   = "capture"
+	CommandSubscribe = "subscribe"
+	CommandCancel    = "cancel"
+)
+
+// Command is a message sent by the client. Without a type it starts a capture
+// of URL, "subscribe" replays the events of JobID after Since and follows it
+// live, "cancel" stops JobID or, without one, the last capture started on the socket.
 type Command struct {
-	URL string `json:"url"`
+	Type     string `json:"type,omitempty"`
+	URL      string `json:"url,omitempty"`
+	Provider string `json:"provider,omitempty"` // openai, anthropic or local, defaults to LLM_PROVIDER
+	Model    string `json:"model,omitempty"`
+	// Mode is segmented (a screenshot per viewport, the default) or fullpage
+	Mode models.CaptureMode `json:"mode,omitempty"`
+	// Devices are built-in profiles referenced by name or custom definitions, desktop when empty
+	Devices []devices.Profile `json:"devices,omitempty"`
+	// Image overrides the server's screenshot format, quality and size budget
+	Image imaging.Options `json:"image,omitempty"`
+	// KeepBanners leaves consent banners and modals on the page, for analyzing them
+	KeepBanners bool `json:"keepBanners,omitempty"`
+	// Steps interact with the page before it is captured, such as opening a menu or filling a form
+	Steps []flow.Step `json:"steps,omitempty"`
+	// Session holds the cookies, headers and storage items of a logged-in capture, it is sealed before it is queued
+	Session *session.Session `json:"session,omitempty"`
+	JobID   string           `json:"jobId,omitempty"`
+	Since   int64            `json:"since,omitempty"`
+}
+
+// identityProvider is the provider recorded for users authenticated with Kinde tokens
+const identityProvider = "kinde"
+
+type AnalysisHandler struct {
+	analysisService *services.AnalysisService
+	userService     *services.UserService
+	progress        progress.Publisher
+	// queue is nil when Redis is not configured, captures then run inside the API process
+	queue   *jobs.Queue
+	cancels jobs.Canceller
+	blobs   blobstore.BlobStore
+	// urlExpiry is how long the signed screenshot URLs returned by the API stay valid
+	urlExpiry time.Duration
+	// sealer encrypts capture sessions, nil when authenticated captures are not configured
+	sealer *session.Sealer
+	runner *JobRunner
+}
+
+// NewAnalysisHandler creates the handler, browsers is only used to run captures
+// inside the API process and may be nil when a queue is given
+func NewAnalysisHandler(analysisService *services.AnalysisService, userService *services.UserService, publisher progress.Publisher, queue *jobs.Queue, canceller jobs.Canceller, browsers *browser.Pool, blobs blobstore.BlobStore) *AnalysisHandler {
+	runner := NewJobRunner(analysisService, publisher, canceller, browsers, blobs)
+	if runner.sealer == nil && queue == nil {
+		// Sessions of captures run in this process never leave it, so any key will do
+		runner.sealer = session.NewEphemeralSealer()
+	}
+	return &AnalysisHandler{
+		analysisService: analysisService,
+		userService:     userService,
+		progress:        publisher,
+		queue:           queue,
+		cancels:         canceller,
+		blobs:           blobs,
+		urlExpiry:       blobstore.URLExpiryFromEnv(),
+		sealer:          runner.sealer,
+		runner:          runner,
+	}
 }
 
-func WebSocketHandler(w http.ResponseWriter, r *http.Request) {
+// socket serializes writes to the connection, which is shared by the command
+// loop and the goroutines relaying job progress
+type socket struct {
+	conn *websocket.Conn
+	lock sync.Mutex
+}
+
+func (s *socket) WriteJSON(v interface{}) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.conn.WriteJSON(v)
+}
+
+func (s *socket) WriteMessage(messageType int, data []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.conn.WriteMessage(messageType, data)
+}
+
+// WebSocketHandler runs the commands received on the socket while the progress
+// of the jobs started or subscribed to is relayed in the background. Passing
+// the jobId (and optionally since) query parameters is the same as sending a
+// subscribe command right after connecting.
+func (h *AnalysisHandler) WebSocketHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println(err)
@@ -27,6 +135,29 @@ func WebSocketHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	defer conn.Close()
 
+	// Relays stop when the client goes away, the jobs themselves keep running
+	ctx, cancel := context.WithCancel(r.Context())
+	var relays sync.WaitGroup
+	defer relays.Wait()
+	defer cancel()
+
+	ws := &socket{conn: conn}
+	relay := func(jobID string, since int64) {
+		relays.Add(1)
+		go func() {
+			defer relays.Done()
+			if err := h.subscribeJob(ctx, ws, user.ID, jobID, since); err != nil {
+				log.Printf("Error relaying job %s: %v", jobID, err)
+			}
+		}()
+	}
+
+	if jobID := r.URL.Query().Get("jobId"); jobID != "" {
+		since, _ := strconv.ParseInt(r.URL.Query().Get("since"), 10, 64)
+		relay(jobID, since)
+	}
+
+	var lastJobID string
 	for {
 		_, message, err := conn.ReadMessage()
 		if err != nil {
@@ -39,20 +170,208 @@ func WebSocketHandler(w http.ResponseWriter, r *http.Request) {
 			log.Printf("Error unmarshaling command: %v", err)
 			continue
 		}
-		ctx := r.Context()
-		scraperInstance := scraper.NewScraper(ctx)
-		screenshotURLs := scraperInstance.CaptureAndUpload(cmd.URL, conn)
 
-		// Send results back to the client
-		response, err := json.Marshal(screenshotURLs)
+		switch cmd.Type {
+		case CommandSubscribe:
+			relay(cmd.JobID, cmd.Since)
+		case "", CommandCapture:
+			var jobID string
+			jobID, err = h.startJob(ctx, ws, user.ID, cmd)
+			if err == nil && jobID != "" {
+				lastJobID = jobID
+				relay(jobID, 0)
+			}
+		case CommandCancel:
+			if cmd.JobID == "" {
+				cmd.JobID = lastJobID
+			}
+			err = h.cancelJob(ctx, ws, user.ID, cmd.JobID)
+		default:
+			err = ws.WriteJSON(progress.Message{Type: "error", Content: "Unknown command type: " + cmd.Type})
+		}
 		if err != nil {
-			log.Printf("Error marshaling response: %v", err)
-			continue
+			log.Printf("Error handling %q command: %v", cmd.Type, err)
+			break
 		}
+	}
+}
+
+// ListDevicesHandler returns the built-in device profiles captures can reference by name
+func (h *AnalysisHandler) ListDevicesHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, devices.Catalogue())
+}
+
+// startJob creates the analysis and hands its job to the worker queue, or runs
+// it in the background when there is none. It returns the ID of the job, or an
+// empty ID when the failure has been reported on the socket.
+func (h *AnalysisHandler) startJob(ctx context.Context, ws *socket, userID uint, cmd Command) (string, error) {
+	provider, err := llm.NewProvider(cmd.Provider, cmd.Model)
+	if err != nil {
+		log.Printf("Error selecting LLM provider: %v", err)
+		return "", ws.WriteJSON(progress.Message{Type: "error", Content: err.Error()})
+	}
+
+	profiles, err := devices.Resolve(cmd.Devices)
+	if err != nil {
+		return "", ws.WriteJSON(progress.Message{Type: "error", Content: err.Error()})
+	}
+
+	image, err := cmd.Image.Resolve(imaging.OptionsFromEnv())
+	if err != nil {
+		return "", ws.WriteJSON(progress.Message{Type: "error", Content: err.Error()})
+	}
 
-		if err := conn.WriteMessage(websocket.TextMessage, response); err != nil {
-			log.Printf("Error sending response: %v", err)
+	if err := flow.Validate(cmd.Steps); err != nil {
+		return "", ws.WriteJSON(progress.Message{Type: "error", Content: err.Error()})
+	}
+
+	if cmd.Mode == "" {
+		cmd.Mode = models.CaptureModeSegmented
+	}
+	if !cmd.Mode.Valid() {
+		return "", ws.WriteJSON(progress.Message{Type: "error", Content: "Unknown capture mode: " + string(cmd.Mode)})
+	}
+
+	var sealedSession string
+	if cmd.Session != nil && !cmd.Session.Empty() {
+		if h.sealer == nil {
+			return "", ws.WriteJSON(progress.Message{Type: "error", Content: "Authenticated captures are not configured"})
+		}
+		if err := cmd.Session.Validate(cmd.URL); err != nil {
+			return "", ws.WriteJSON(progress.Message{Type: "error", Content: err.Error()})
+		}
+		if sealedSession, err = h.sealer.Seal(*cmd.Session); err != nil {
+			log.Printf("Error sealing capture session: %v", err)
+			return "", ws.WriteJSON(progress.Message{Type: "error", Content: "Failed to store the capture session"})
+		}
+	}
+
+	jobID := jobs.NewJobID()
+	analysis, err := h.analysisService.CreateAnalysis(ctx, userID, jobID, cmd.URL, cmd.Mode, provider)
+	if err != nil {
+		log.Printf("Error creating analysis: %v", err)
+		return "", ws.WriteJSON(progress.Message{Type: "error", Content: "Failed to create analysis"})
+	}
+
+	// The first event of the job carries its ID, which the client needs to resubscribe
+	h.progress.Publish(ctx, jobID, progress.Message{Type: "status", Content: "Your request has been received"})
+	h.progress.Publish(ctx, jobID, progress.Message{Type: "analysis_created", Content: map[string]interface{}{"analysisId": analysis.ID, "status": analysis.Status}})
+
+	job := jobs.CaptureJob{
+		ID:          jobID,
+		AnalysisID:  analysis.ID,
+		UserID:      userID,
+		URL:         cmd.URL,
+		Provider:    cmd.Provider,
+		Model:       cmd.Model,
+		Devices:     profiles,
+		Image:       image,
+		KeepBanners: cmd.KeepBanners,
+		Steps:       cmd.Steps,
+		Session:     sealedSession,
+	}
+	if h.queue == nil {
+		// The capture outlives the socket so a reconnecting client can pick it up again
+		go func() {
+			if err := h.runner.Run(context.Background(), job); err != nil {
+				log.Printf("Job %s failed: %v", job.ID, err)
+			}
+		}()
+	} else if err := h.queue.Enqueue(ctx, job); err != nil {
+		log.Printf("Error enqueueing job %s: %v", job.ID, err)
+		h.progress.Publish(ctx, jobID, progress.Message{Type: "error", Content: "Failed to queue capture"})
+		if err := h.analysisService.FailAnalysis(context.Background(), analysis, "Failed to queue capture"); err != nil {
+			log.Printf("Failed to mark analysis %d as failed: %v", analysis.ID, err)
+		}
+		h.progress.Publish(ctx, jobID, progress.Message{Type: "finished", Content: map[string]interface{}{"analysisId": analysis.ID, "status": analysis.Status}})
+	}
+
+	return jobID, nil
+}
+
+// cancelJob asks the process running a job of the user to stop it. The job
+// reports the cancellation through its progress events.
+func (h *AnalysisHandler) cancelJob(ctx context.Context, ws *socket, userID uint, jobID string) error {
+	if jobID == "" {
+		return ws.WriteJSON(progress.Message{Type: "error", Content: "No job to cancel"})
+	}
+
+	analysis, err := h.analysisService.GetAnalysisByJobID(ctx, userID, jobID)
+	if err != nil {
+		return err
+	}
+	if analysis == nil {
+		return ws.WriteJSON(progress.Message{Type: "error", Content: "Job not found"})
+	}
+	if analysis.Status.IsFinished() {
+		return ws.WriteJSON(progress.Message{Type: "error", JobID: jobID, Content: "Job has already finished"})
+	}
+
+	if err := h.cancels.Cancel(ctx, jobID); err != nil {
+		log.Printf("Error cancelling job %s: %v", jobID, err)
+		return ws.WriteJSON(progress.Message{Type: "error", JobID: jobID, Content: "Failed to cancel job"})
+	}
+	return nil
+}
+
+// subscribeJob replays the events of a job of the user published after since
+// and then follows the job live until it finishes
+func (h *AnalysisHandler) subscribeJob(ctx context.Context, ws *socket, userID uint, jobID string, since int64) error {
+	analysis, err := h.analysisService.GetAnalysisByJobID(ctx, userID, jobID)
+	if err != nil {
+		return err
+	}
+	if analysis == nil {
+		return ws.WriteJSON(progress.Message{Type: "error", Content: "Job not found"})
+	}
+
+	subscription, err := h.progress.Subscribe(ctx, jobID, since)
+	if err != nil {
+		return err
+	}
+	defer subscription.Close()
+
+	// Reload after subscribing in case the job finished in between
+	analysis, err = h.analysisService.GetAnalysisByJobID(ctx, userID, jobID)
+	if err != nil {
+		return err
+	}
+
+	return relayProgress(ws, subscription, analysis)
+}
+
+// relayProgress forwards job progress to the socket until the job finishes. When
+// the analysis has already finished only the replayed events are sent, followed
+// by a finished event if the log no longer contains one.
+func relayProgress(ws *socket, subscription *progress.Subscription, analysis *models.Analysis) error {
+	finished := analysis.Status.IsFinished()
+	for {
+		var payload []byte
+		var ok bool
+		if finished {
+			select {
+			case payload, ok = <-subscription.Messages():
+			default:
+			}
+		} else {
+			payload, ok = <-subscription.Messages()
+		}
+		if !ok {
 			break
 		}
+
+		if err := ws.WriteMessage(websocket.TextMessage, payload); err != nil {
+			return err
+		}
+
+		var msg progress.Message
+		if err := json.Unmarshal(payload, &msg); err == nil && msg.Type == "finished" {
+			return nil
+		}
+	}
+
+	if finished {
+		return ws.WriteJSON(progress.Message{Type: "finished", JobID: analysis.JobID, Content: map[string]interface{}{"analysisId": analysis.ID, "status": analysis.Status}})
 	}
+	return nil
 }
@@ -0,0 +1,215 @@
+package consent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/chromedp"
+)
+
+// Action is the answer given to consent banners
+type Action string
+
+const (
+	ActionAccept Action = "accept"
+	ActionReject Action = "reject"
+)
+
+// Dismisser closes consent banners and modal dialogs that cover the page, so
+// the capture shows the page rather than the overlay
+type Dismisser struct {
+	// rules holds the per-domain overrides ahead of the built-in rules
+	rules  []Rule
+	action Action
+}
+
+// Result describes what a dismissal did, it is sent to the job log
+type Result struct {
+	// Rule is the rule whose banner was found, "generic" when the heuristics found it
+	Rule    string   `json:"rule,omitempty"`
+	Clicked []string `json:"clicked,omitempty"`
+	// Hidden counts the overlays removed because no button closed them
+	Hidden int `json:"hidden"`
+	// Skipped is set when a domain rule turned dismissal off
+	Skipped bool `json:"skipped,omitempty"`
+}
+
+// Dismissed reports whether anything was closed or hidden
+func (r Result) Dismissed() bool {
+	return len(r.Clicked) > 0 || r.Hidden > 0
+}
+
+func NewDismisser(overrides []Rule, action Action) *Dismisser {
+	if action != ActionReject {
+		action = ActionAccept
+	}
+	return &Dismisser{rules: append(append([]Rule(nil), overrides...), builtinRules...), action: action}
+}
+
+// NewDismisserFromEnv answers banners with CONSENT_ACTION (accept, the
+// default, or reject) and reads per-domain rules from the JSON file at
+// CONSENT_RULES_FILE. Invalid rules are logged and ignored.
+func NewDismisserFromEnv() *Dismisser {
+	var overrides []Rule
+	if path := os.Getenv("CONSENT_RULES_FILE"); path != "" {
+		rules, err := LoadRules(path)
+		if err != nil {
+			log.Printf("Ignoring consent rules: %v", err)
+		}
+		overrides = rules
+	}
+	return NewDismisser(overrides, Action(os.Getenv("CONSENT_ACTION")))
+}
+
+// Dismiss closes the overlays on the page loaded in the tab of ctx
+func (d *Dismisser) Dismiss(ctx context.Context) (Result, error) {
+	var location string
+	if err := chromedp.Run(ctx, chromedp.Location(&location)); err != nil {
+		return Result{}, err
+	}
+	host := ""
+	if parsed, err := url.Parse(location); err == nil {
+		host = parsed.Hostname()
+	}
+
+	var rules []Rule
+	for _, rule := range d.rules {
+		if !rule.matches(host) {
+			continue
+		}
+		if rule.Skip {
+			return Result{Rule: rule.Name, Skipped: true}, nil
+		}
+		rules = append(rules, rule)
+	}
+	encoded, err := json.Marshal(rules)
+	if err != nil {
+		return Result{}, err
+	}
+
+	var result Result
+	script := fmt.Sprintf(dismissScript, encoded, d.action)
+	awaitPromise := func(p *runtime.EvaluateParams) *runtime.EvaluateParams { return p.WithAwaitPromise(true) }
+	if err := chromedp.Run(ctx, chromedp.Evaluate(script, &result, awaitPromise)); err != nil {
+		return Result{}, err
+	}
+	return result, nil
+}
+
+// dismissScript tries the rules first, then looks for consent buttons by
+// their text inside dialogs and cookie or consent containers, then closes
+// remaining modal dialogs. Overlays still visible after a click are hidden
+// and the page is made scrollable again.
+const dismissScript = `(async (rules, action) => {
+	const visible = (el) => {
+		if (!el || !el.isConnected) {
+			return false;
+		}
+		const style = window.getComputedStyle(el);
+		const rect = el.getBoundingClientRect();
+		return style.display !== 'none' && style.visibility !== 'hidden' && style.opacity !== '0' && rect.width > 0 && rect.height > 0;
+	};
+	const find = (selector, root = document) => {
+		if (!selector) {
+			return null;
+		}
+		try {
+			return Array.from(root.querySelectorAll(selector)).find(visible) || null;
+		} catch (e) {
+			return null;
+		}
+	};
+	const wait = (ms) => new Promise(resolve => setTimeout(resolve, ms));
+	const label = (el) => (el.innerText || el.value || el.getAttribute('aria-label') || '').trim().replace(/\s+/g, ' ');
+	const normalize = (text) => text.toLowerCase().replace(/[.!,:;]+$/, '');
+
+	const result = { rule: '', clicked: [], hidden: 0 };
+	const hide = (el) => {
+		el.style.setProperty('display', 'none', 'important');
+		result.hidden++;
+	};
+	const closeOverlay = async (overlay, button, description) => {
+		button.click();
+		result.clicked.push(description);
+		await wait(500);
+		if (visible(overlay)) {
+			hide(overlay);
+		}
+	};
+
+	for (const rule of rules) {
+		const banner = find(rule.banner);
+		if (!banner) {
+			continue;
+		}
+		result.rule = rule.name;
+		const selectors = action === 'reject' ? [rule.reject, rule.accept] : [rule.accept, rule.reject];
+		const button = selectors.map(selector => find(selector)).find(Boolean);
+		if (button) {
+			await closeOverlay(banner, button, rule.name + ': ' + label(button));
+		} else {
+			hide(banner);
+		}
+		break;
+	}
+
+	const acceptText = /^(accept|accept all|accept all cookies|accept cookies|allow all|allow all cookies|allow cookies|agree|i agree|agree and close|agree and continue|got it|ok|okay|i understand|alle akzeptieren|akzeptieren|alle cookies akzeptieren|zustimmen|einverstanden|tout accepter|accepter|accepter et fermer|j'accepte|aceptar|aceptar todo|aceptar todas|accetta|accetta tutti|accetto|accepteren|alles accepteren|akkoord|aceitar|aceitar todos|zaakceptuj|akceptuję|godkänn|acceptera|godta|accepter alle)$/;
+	const rejectText = /^(reject|reject all|reject all cookies|decline|decline all|deny|deny all|refuse|refuse all|necessary only|only necessary|use necessary cookies only|only essential|essential only|ablehnen|alle ablehnen|nur notwendige|tout refuser|refuser|continuer sans accepter|rechazar|rechazar todo|rifiuta|rifiuta tutti|weigeren|alles weigeren|rejeitar|odrzuć|avvisa|neka|afvis)$/;
+	const containers = '[role="dialog"], [role="alertdialog"], [aria-modal="true"], [id*="cookie" i], [class*="cookie" i], [id*="consent" i], [class*="consent" i], [id*="gdpr" i], [class*="gdpr" i], [id*="privacy" i], [class*="privacy" i]';
+	const buttons = 'button, a, [role="button"], input[type="button"], input[type="submit"]';
+	// The overlay of a button is its outermost container that floats above the page
+	const overlayOf = (el) => {
+		let overlay = el.closest(containers) || el;
+		for (let node = el; node && node !== document.body; node = node.parentElement) {
+			const position = window.getComputedStyle(node).position;
+			if (position === 'fixed' || position === 'sticky') {
+				overlay = node;
+			}
+		}
+		return overlay;
+	};
+
+	if (!result.rule) {
+		const candidates = Array.from(document.querySelectorAll(containers)).filter(visible)
+			.flatMap(container => Array.from(container.querySelectorAll(buttons)))
+			.filter(visible);
+		const patterns = action === 'reject' ? [rejectText, acceptText] : [acceptText, rejectText];
+		for (const pattern of patterns) {
+			const button = candidates.find(el => pattern.test(normalize(label(el))));
+			if (button) {
+				result.rule = 'generic';
+				await closeOverlay(overlayOf(button), button, 'generic: ' + label(button));
+				break;
+			}
+		}
+	}
+
+	// Newsletter and promotion modals
+	const closeButtons = '[aria-label*="close" i], [aria-label*="schließen" i], [aria-label*="fermer" i], [aria-label*="cerrar" i], [aria-label*="dismiss" i], [data-dismiss="modal"], [data-bs-dismiss="modal"], .modal-close, .close';
+	for (const dialog of Array.from(document.querySelectorAll('[role="dialog"], [aria-modal="true"], dialog[open]')).filter(visible)) {
+		const button = find(closeButtons, dialog) || Array.from(dialog.querySelectorAll(buttons)).filter(visible).find(el => /^(×|✕|✖|x)$/i.test(label(el)));
+		if (button) {
+			await closeOverlay(overlayOf(dialog), button, 'modal: ' + (label(button) || 'close'));
+		}
+	}
+
+	if (result.clicked.length > 0 || result.hidden > 0) {
+		document.querySelectorAll('.modal-backdrop').forEach(el => {
+			if (visible(el)) {
+				hide(el);
+			}
+		});
+		// Overlays often lock scrolling while they are open
+		for (const el of [document.documentElement, document.body]) {
+			if (window.getComputedStyle(el).overflowY === 'hidden') {
+				el.style.setProperty('overflow-y', 'auto', 'important');
+			}
+		}
+	}
+	return result;
+})(%s, %q)`
@@ -0,0 +1,79 @@
+package consent
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Rule recognises the banner of a consent management platform and the
+// buttons that close it
+type Rule struct {
+	Name string `json:"name"`
+	// Domains limits the rule to these hosts and their subdomains, rules without domains apply everywhere
+	Domains []string `json:"domains,omitempty"`
+	// Banner is a CSS selector matching the banner or dialog, it is hidden when no button closes it
+	Banner string `json:"banner"`
+	Accept string `json:"accept,omitempty"`
+	Reject string `json:"reject,omitempty"`
+	// Skip turns dismissal off on the rule's domains, so their pages are captured as served
+	Skip bool `json:"skip,omitempty"`
+}
+
+// builtinRules covers the most common consent management platforms
+var builtinRules = []Rule{
+	{Name: "onetrust", Banner: "#onetrust-consent-sdk", Accept: "#onetrust-accept-btn-handler", Reject: "#onetrust-reject-all-handler"},
+	{Name: "cookiebot", Banner: "#CybotCookiebotDialog", Accept: "#CybotCookiebotDialogBodyLevelButtonLevelOptinAllowAll, #CybotCookiebotDialogBodyButtonAccept", Reject: "#CybotCookiebotDialogBodyButtonDecline"},
+	{Name: "didomi", Banner: "#didomi-host", Accept: "#didomi-notice-agree-button", Reject: "#didomi-notice-disagree-button, .didomi-continue-without-agreeing"},
+	{Name: "quantcast", Banner: "#qc-cmp2-container", Accept: ".qc-cmp2-summary-buttons button[mode=\"primary\"]", Reject: ".qc-cmp2-summary-buttons button[mode=\"secondary\"]"},
+	{Name: "trustarc", Banner: "#truste-consent-track", Accept: "#truste-consent-button", Reject: "#truste-consent-required"},
+	{Name: "cookieyes", Banner: ".cky-consent-container", Accept: ".cky-btn-accept", Reject: ".cky-btn-reject"},
+	{Name: "osano", Banner: ".osano-cm-window", Accept: ".osano-cm-accept-all", Reject: ".osano-cm-denyAll"},
+	{Name: "complianz", Banner: "#cmplz-cookiebanner-container", Accept: ".cmplz-accept", Reject: ".cmplz-deny"},
+	{Name: "cookie-notice", Banner: "#cookie-notice", Accept: "#cn-accept-cookie", Reject: "#cn-refuse-cookie"},
+	{Name: "borlabs", Banner: "#BorlabsCookieBox", Accept: "#BorlabsCookieBox a._brlbs-btn-accept-all", Reject: "#BorlabsCookieBox a._brlbs-refuse-btn"},
+	// Sourcepoint renders its buttons in a cross-origin frame, the banner can only be hidden
+	{Name: "sourcepoint", Banner: "div[id^=\"sp_message_container\"]"},
+}
+
+// Rules returns the built-in rules
+func Rules() []Rule {
+	return append([]Rule(nil), builtinRules...)
+}
+
+// LoadRules reads per-domain rules from a JSON array in the file at path
+func LoadRules(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("invalid consent rules in %s: %v", path, err)
+	}
+	for i, rule := range rules {
+		if len(rule.Domains) == 0 {
+			return nil, fmt.Errorf("consent rule %d (%s) in %s has no domains", i, rule.Name, path)
+		}
+		if !rule.Skip && rule.Banner == "" {
+			return nil, fmt.Errorf("consent rule %d (%s) in %s has no banner selector", i, rule.Name, path)
+		}
+	}
+	return rules, nil
+}
+
+// matches reports whether the rule applies to pages on host
+func (r Rule) matches(host string) bool {
+	if len(r.Domains) == 0 {
+		return true
+	}
+	host = strings.ToLower(host)
+	for _, domain := range r.Domains {
+		domain = strings.ToLower(strings.TrimPrefix(domain, "."))
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package devices
+
+import (
+	"fmt"
+	"sort"
+)
+
+const (
+	desktopUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36"
+	mobileUserAgent  = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1"
+
+	// MaxProfiles is how many devices a single capture may emulate
+	MaxProfiles = 4
+
+	minWidth, maxWidth   = 320, 3840
+	minHeight, maxHeight = 480, 2160
+	maxScaleFactor       = 4
+)
+
+// Profile describes the device a page is captured on
+type Profile struct {
+	Name              string  `json:"name"`
+	Width             int64   `json:"width,omitempty"`
+	Height            int64   `json:"height,omitempty"`
+	DeviceScaleFactor float64 `json:"deviceScaleFactor,omitempty"`
+	Mobile            bool    `json:"mobile,omitempty"`
+	Touch             bool    `json:"touch,omitempty"`
+	UserAgent         string  `json:"userAgent,omitempty"`
+}
+
+// catalogue holds the built-in profiles, referenced by name in capture commands
+var catalogue = map[string]Profile{
+	"desktop": {Name: "desktop", Width: 1920, Height: 1080, DeviceScaleFactor: 1, UserAgent: desktopUserAgent},
+	"laptop":  {Name: "laptop", Width: 1366, Height: 768, DeviceScaleFactor: 1, UserAgent: desktopUserAgent},
+	"tablet": {Name: "tablet", Width: 820, Height: 1180, DeviceScaleFactor: 2, Mobile: true, Touch: true,
+		UserAgent: "Mozilla/5.0 (iPad; CPU OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1"},
+	"mobile": {Name: "mobile", Width: 390, Height: 844, DeviceScaleFactor: 3, Mobile: true, Touch: true, UserAgent: mobileUserAgent},
+	"android": {Name: "android", Width: 412, Height: 915, DeviceScaleFactor: 2.625, Mobile: true, Touch: true,
+		UserAgent: "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36"},
+}
+
+// Default is the profile used when a capture does not ask for any
+func Default() Profile {
+	return catalogue["desktop"]
+}
+
+// Catalogue returns the built-in profiles sorted by name
+func Catalogue() []Profile {
+	profiles := make([]Profile, 0, len(catalogue))
+	for _, profile := range catalogue {
+		profiles = append(profiles, profile)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+	return profiles
+}
+
+// Resolve turns the profiles of a capture command into complete ones. A
+// profile with only a name refers to the catalogue, one with dimensions is a
+// custom definition. Without profiles the default one is used.
+func Resolve(requested []Profile) ([]Profile, error) {
+	if len(requested) == 0 {
+		return []Profile{Default()}, nil
+	}
+	if len(requested) > MaxProfiles {
+		return nil, fmt.Errorf("at most %d device profiles can be captured at once", MaxProfiles)
+	}
+
+	profiles := make([]Profile, 0, len(requested))
+	seen := make(map[string]bool)
+	for _, profile := range requested {
+		if profile.Width == 0 && profile.Height == 0 {
+			builtIn, ok := catalogue[profile.Name]
+			if !ok {
+				return nil, fmt.Errorf("unknown device profile %q", profile.Name)
+			}
+			profile = builtIn
+		} else if err := validate(&profile); err != nil {
+			return nil, err
+		}
+
+		if seen[profile.Name] {
+			return nil, fmt.Errorf("device profile %q is listed more than once", profile.Name)
+		}
+		seen[profile.Name] = true
+		profiles = append(profiles, profile)
+	}
+	return profiles, nil
+}
+
+// validate checks a custom profile and fills in the optional fields
+func validate(profile *Profile) error {
+	if profile.Name == "" {
+		return fmt.Errorf("custom device profiles need a name")
+	}
+	if _, ok := catalogue[profile.Name]; ok {
+		return fmt.Errorf("custom device profile %q has the name of a built-in profile", profile.Name)
+	}
+	if profile.Width < minWidth || profile.Width > maxWidth {
+		return fmt.Errorf("width of device profile %q must be between %d and %d", profile.Name, minWidth, maxWidth)
+	}
+	if profile.Height < minHeight || profile.Height > maxHeight {
+		return fmt.Errorf("height of device profile %q must be between %d and %d", profile.Name, minHeight, maxHeight)
+	}
+	if profile.DeviceScaleFactor == 0 {
+		profile.DeviceScaleFactor = 1
+	}
+	if profile.DeviceScaleFactor < 0 || profile.DeviceScaleFactor > maxScaleFactor {
+		return fmt.Errorf("device scale factor of device profile %q must be between 0 and %d", profile.Name, maxScaleFactor)
+	}
+	if profile.UserAgent == "" {
+		profile.UserAgent = desktopUserAgent
+		if profile.Mobile {
+			profile.UserAgent = mobileUserAgent
+		}
+	}
+	return nil
+}
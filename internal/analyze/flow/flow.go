@@ -0,0 +1,113 @@
+package flow
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+const (
+	// MaxSteps is how many steps a single capture may run
+	MaxSteps = 50
+
+	defaultTimeout = 10 * time.Second
+	maxTimeout     = 60 * time.Second
+)
+
+// Action is what a step does
+type Action string
+
+const (
+	ActionClick              Action = "click"
+	ActionType               Action = "type"
+	ActionSelect             Action = "select"
+	ActionHover              Action = "hover"
+	ActionWaitForSelector    Action = "waitForSelector"
+	ActionWaitForNetworkIdle Action = "waitForNetworkIdle"
+	ActionScroll             Action = "scroll"
+	ActionNavigate           Action = "navigate"
+	// ActionScreenshot stores a screenshot of the viewport in the state the steps before it left the page in
+	ActionScreenshot Action = "screenshot"
+)
+
+// Step is an interaction run on the page before it is captured, so states
+// such as an open menu or a filled form can be analyzed
+type Step struct {
+	Action Action `json:"action"`
+	// Name labels the step in progress events, failure messages and screenshots
+	Name string `json:"name,omitempty"`
+	// Selector is a CSS selector of the element the step acts on or waits for
+	Selector string `json:"selector,omitempty"`
+	// Value is the text typed or the value of the option selected, it is never reported back
+	Value string `json:"value,omitempty"`
+	// URL is the page loaded by a navigate step
+	URL string `json:"url,omitempty"`
+	// Y is the scroll offset in CSS pixels of a scroll step without a selector
+	Y int `json:"y,omitempty"`
+	// Timeout is how long the step may wait, in milliseconds, 10 seconds by default
+	Timeout int `json:"timeout,omitempty"`
+}
+
+// String describes the step without the typed value, which may be a password
+func (s Step) String() string {
+	description := string(s.Action)
+	switch {
+	case s.Action == ActionNavigate:
+		description += " " + s.URL
+	case s.Action == ActionScroll && s.Selector == "":
+		description += fmt.Sprintf(" to %dpx", s.Y)
+	case s.Selector != "":
+		description += " " + s.Selector
+	}
+	if s.Name != "" {
+		description += fmt.Sprintf(" (%s)", s.Name)
+	}
+	return description
+}
+
+// TimeoutDuration is how long the step may wait
+func (s Step) TimeoutDuration() time.Duration {
+	if s.Timeout <= 0 {
+		return defaultTimeout
+	}
+	return time.Duration(s.Timeout) * time.Millisecond
+}
+
+// Validate checks the steps of a capture command, errors name the step by its
+// position starting at 1
+func Validate(steps []Step) error {
+	if len(steps) > MaxSteps {
+		return fmt.Errorf("at most %d steps can be run before a capture", MaxSteps)
+	}
+	for i, step := range steps {
+		if err := validate(step); err != nil {
+			return fmt.Errorf("step %d (%s): %v", i+1, step.Action, err)
+		}
+	}
+	return nil
+}
+
+func validate(step Step) error {
+	switch step.Action {
+	case ActionClick, ActionType, ActionSelect, ActionHover, ActionWaitForSelector:
+		if step.Selector == "" {
+			return fmt.Errorf("needs a selector")
+		}
+	case ActionNavigate:
+		parsed, err := url.Parse(step.URL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("needs an http or https URL")
+		}
+	case ActionScroll:
+		if step.Selector == "" && step.Y < 0 {
+			return fmt.Errorf("needs a selector or an offset of at least 0")
+		}
+	case ActionWaitForNetworkIdle, ActionScreenshot:
+	default:
+		return fmt.Errorf("unknown action %q", step.Action)
+	}
+	if step.Timeout < 0 || step.TimeoutDuration() > maxTimeout {
+		return fmt.Errorf("timeout must be between 0 and %d milliseconds", maxTimeout.Milliseconds())
+	}
+	return nil
+}
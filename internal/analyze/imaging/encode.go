@@ -0,0 +1,249 @@
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"log"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+
+	"github.com/chai2010/webp"
+	"golang.org/x/image/draw"
+)
+
+type Format string
+
+const (
+	FormatPNG  Format = "png"
+	FormatJPEG Format = "jpeg"
+	FormatWebP Format = "webp"
+	FormatAVIF Format = "avif"
+)
+
+const (
+	defaultFormat   = FormatWebP
+	defaultQuality  = 80
+	defaultMaxBytes = 2 << 20
+	// minQuality is the lowest quality lossy formats are reduced to before images are downscaled
+	minQuality = 50
+	// minWidth is the narrowest an image is downscaled to when it does not fit the budget
+	minWidth = 320
+)
+
+// Valid reports whether f is a supported format
+func (f Format) Valid() bool {
+	switch f {
+	case FormatPNG, FormatJPEG, FormatWebP, FormatAVIF:
+		return true
+	}
+	return false
+}
+
+func (f Format) ContentType() string {
+	return "image/" + string(f)
+}
+
+func (f Format) Extension() string {
+	if f == FormatJPEG {
+		return ".jpg"
+	}
+	return "." + string(f)
+}
+
+func (f Format) lossy() bool {
+	return f != FormatPNG
+}
+
+// maxDimension is the largest width or height the format can encode, zero when there is no limit
+func (f Format) maxDimension() int {
+	switch f {
+	case FormatWebP:
+		return 16383
+	case FormatJPEG, FormatAVIF:
+		return 65535
+	}
+	return 0
+}
+
+// Options control how screenshots are encoded before they are uploaded
+type Options struct {
+	Format Format `json:"format,omitempty"`
+	// Quality applies to the lossy formats, from 1 to 100
+	Quality int `json:"quality,omitempty"`
+	// MaxBytes is the size budget of an image, images are recompressed and
+	// downscaled until they fit. Zero leaves the size unbounded.
+	MaxBytes int `json:"maxBytes,omitempty"`
+}
+
+// OptionsFromEnv reads the default options from SCREENSHOT_FORMAT, SCREENSHOT_QUALITY and SCREENSHOT_MAX_BYTES
+func OptionsFromEnv() Options {
+	options := Options{
+		Format:   Format(os.Getenv("SCREENSHOT_FORMAT")),
+		Quality:  defaultQuality,
+		MaxBytes: defaultMaxBytes,
+	}
+	if !options.Format.Valid() {
+		options.Format = defaultFormat
+	}
+	if value, err := strconv.Atoi(os.Getenv("SCREENSHOT_QUALITY")); err == nil && value >= 1 && value <= 100 {
+		options.Quality = value
+	}
+	if value, err := strconv.Atoi(os.Getenv("SCREENSHOT_MAX_BYTES")); err == nil && value >= 0 {
+		options.MaxBytes = value
+	}
+	return options
+}
+
+// Resolve fills the options left empty from defaults and validates the result
+func (o Options) Resolve(defaults Options) (Options, error) {
+	if o.Format == "" {
+		o.Format = defaults.Format
+	}
+	if o.Quality == 0 {
+		o.Quality = defaults.Quality
+	}
+	if o.MaxBytes == 0 {
+		o.MaxBytes = defaults.MaxBytes
+	}
+
+	if !o.Format.Valid() {
+		return o, fmt.Errorf("unsupported image format %q", o.Format)
+	}
+	if o.Quality < 1 || o.Quality > 100 {
+		return o, fmt.Errorf("image quality must be between 1 and 100")
+	}
+	if o.MaxBytes < 0 {
+		return o, fmt.Errorf("image size budget must not be negative")
+	}
+	return o, nil
+}
+
+// Encoded is an encoded image ready for upload
+type Encoded struct {
+	Data   []byte
+	Format Format
+	Width  int
+	Height int
+	// WithinBudget is false when the image is still larger than MaxBytes at the minimum width
+	WithinBudget bool
+}
+
+// Encode converts a screenshot to the requested format. When it exceeds the
+// size budget the quality of lossy formats is lowered first, then the image is
+// downscaled. AVIF needs the avifenc tool of libavif, without it WebP is used.
+func Encode(data []byte, options Options) (*Encoded, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode screenshot: %v", err)
+	}
+
+	format := options.Format
+	if format == FormatAVIF && avifencPath() == "" {
+		log.Println("avifenc is not installed, encoding screenshots as WebP")
+		format = FormatWebP
+	}
+
+	// Tall full page captures exceed what WebP can encode
+	if limit := format.maxDimension(); limit > 0 {
+		if bounds := img.Bounds(); bounds.Dx() > limit || bounds.Dy() > limit {
+			width := max(bounds.Dx()*limit/max(bounds.Dx(), bounds.Dy()), 1)
+			log.Printf("Screenshot is %dx%d, larger than %s allows, downscaling it to %dpx wide", bounds.Dx(), bounds.Dy(), format, width)
+			img = resize(img, width)
+		}
+	}
+
+	quality := options.Quality
+	for {
+		encoded, err := encode(img, format, quality)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode screenshot as %s: %v", format, err)
+		}
+
+		bounds := img.Bounds()
+		result := &Encoded{Data: encoded, Format: format, Width: bounds.Dx(), Height: bounds.Dy(), WithinBudget: true}
+		if options.MaxBytes == 0 || len(encoded) <= options.MaxBytes {
+			return result, nil
+		}
+
+		if format.lossy() && quality > minQuality {
+			quality = max(quality-15, minQuality)
+			continue
+		}
+		if bounds.Dx() <= minWidth {
+			result.WithinBudget = false
+			return result, nil
+		}
+
+		// The encoded size grows roughly with the pixel count
+		scale := math.Sqrt(float64(options.MaxBytes)/float64(len(encoded))) * 0.95
+		img = resize(img, max(int(float64(bounds.Dx())*scale), minWidth))
+	}
+}
+
+func encode(img image.Image, format Format, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case FormatPNG:
+		return EncodePNG(img)
+	case FormatJPEG:
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	case FormatWebP:
+		err = webp.Encode(&buf, img, &webp.Options{Quality: float32(quality)})
+	case FormatAVIF:
+		return encodeAVIF(img, quality)
+	default:
+		err = fmt.Errorf("unsupported image format %q", format)
+	}
+	return buf.Bytes(), err
+}
+
+// resize scales the image down to width, keeping its aspect ratio
+func resize(img image.Image, width int) image.Image {
+	bounds := img.Bounds()
+	height := max(bounds.Dy()*width/bounds.Dx(), 1)
+	resized := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(resized, resized.Bounds(), img, bounds, draw.Src, nil)
+	return resized
+}
+
+// avifencPath is the avifenc binary from AVIFENC_PATH or the PATH, empty when it is not installed
+func avifencPath() string {
+	if path := os.Getenv("AVIFENC_PATH"); path != "" {
+		return path
+	}
+	path, err := exec.LookPath("avifenc")
+	if err != nil {
+		return ""
+	}
+	return path
+}
+
+func encodeAVIF(img image.Image, quality int) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "avif")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	png, err := EncodePNG(img)
+	if err != nil {
+		return nil, err
+	}
+	input := filepath.Join(dir, "input.png")
+	output := filepath.Join(dir, "output.avif")
+	if err := os.WriteFile(input, png, 0o600); err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(avifencPath(), "--speed", "6", "-q", strconv.Itoa(quality), input, output)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("avifenc failed: %v: %s", err, out)
+	}
+	return os.ReadFile(output)
+}
@@ -0,0 +1,50 @@
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+)
+
+// Tile is a viewport screenshot taken at a vertical offset of the page
+type Tile struct {
+	// Image holds the encoded screenshot
+	Image []byte
+	// OffsetY is where the top of the screenshot lies on the page, in image pixels
+	OffsetY int
+}
+
+// Stitch draws the tiles onto a single image of the given height. Tiles may
+// overlap, later ones are drawn over earlier ones, and whatever lies below
+// height is cut off. The width is that of the first tile.
+func Stitch(tiles []Tile, height int) (*image.RGBA, error) {
+	if len(tiles) == 0 {
+		return nil, fmt.Errorf("no tiles to stitch")
+	}
+
+	var canvas *image.RGBA
+	for i, tile := range tiles {
+		img, _, err := image.Decode(bytes.NewReader(tile.Image))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode tile %d: %v", i, err)
+		}
+		if canvas == nil {
+			canvas = image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), height))
+		}
+
+		target := image.Rect(0, tile.OffsetY, img.Bounds().Dx(), tile.OffsetY+img.Bounds().Dy())
+		draw.Draw(canvas, target.Intersect(canvas.Bounds()), img, img.Bounds().Min, draw.Src)
+	}
+	return canvas, nil
+}
+
+// EncodePNG encodes the image as PNG
+func EncodePNG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,153 @@
+package insights
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+var Categories = []string{"usability", "accessibility", "visual_hierarchy", "layout", "typography", "color", "content", "performance"}
+
+var Severities = []string{"critical", "high", "medium", "low"}
+
+// BoundingBox is the region of the screenshot an insight refers to, in screenshot pixels
+type BoundingBox struct {
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+type Insight struct {
+	Category        string       `json:"category"`
+	Severity        string       `json:"severity"`
+	Title           string       `json:"title"`
+	Description     string       `json:"description"`
+	ScreenshotIndex int          `json:"screenshotIndex"`
+	BoundingBox     *BoundingBox `json:"boundingBox"`
+	RecommendedFix  string       `json:"recommendedFix"`
+}
+
+type Report struct {
+	Summary  string    `json:"summary"`
+	Insights []Insight `json:"insights"`
+}
+
+// SchemaName identifies the report schema in structured output requests
+const SchemaName = "insight_report"
+
+// Schema returns the JSON schema of Report. It follows the strict structured
+// outputs subset: every property is required and no additional properties are allowed.
+func Schema() map[string]interface{} {
+	boundingBox := map[string]interface{}{
+		"type": []string{"object", "null"},
+		"properties": map[string]interface{}{
+			"x":      map[string]interface{}{"type": "number"},
+			"y":      map[string]interface{}{"type": "number"},
+			"width":  map[string]interface{}{"type": "number"},
+			"height": map[string]interface{}{"type": "number"},
+		},
+		"required":             []string{"x", "y", "width", "height"},
+		"additionalProperties": false,
+	}
+
+	insight := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"category":        map[string]interface{}{"type": "string", "enum": Categories},
+			"severity":        map[string]interface{}{"type": "string", "enum": Severities},
+			"title":           map[string]interface{}{"type": "string"},
+			"description":     map[string]interface{}{"type": "string"},
+			"screenshotIndex": map[string]interface{}{"type": "integer"},
+			"boundingBox":     boundingBox,
+			"recommendedFix":  map[string]interface{}{"type": "string"},
+		},
+		"required":             []string{"category", "severity", "title", "description", "screenshotIndex", "boundingBox", "recommendedFix"},
+		"additionalProperties": false,
+	}
+
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"summary":  map[string]interface{}{"type": "string"},
+			"insights": map[string]interface{}{"type": "array", "items": insight},
+		},
+		"required":             []string{"summary", "insights"},
+		"additionalProperties": false,
+	}
+}
+
+// Parse decodes the model output into a Report and validates it against the
+// number of screenshots that were sent with the prompt
+func Parse(text string, screenshotCount int) (*Report, error) {
+	text = strings.TrimSpace(text)
+	// Some models wrap JSON in a markdown code fence even when asked not to
+	text = strings.TrimPrefix(text, "```json")
+	text = strings.TrimPrefix(text, "```")
+	text = strings.TrimSuffix(text, "```")
+
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.DisallowUnknownFields()
+
+	var report Report
+	if err := decoder.Decode(&report); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+
+	if err := report.Validate(screenshotCount); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+func (r *Report) Validate(screenshotCount int) error {
+	var problems []string
+
+	if r.Insights == nil {
+		problems = append(problems, "insights is missing")
+	}
+
+	for i, insight := range r.Insights {
+		if !contains(Categories, insight.Category) {
+			problems = append(problems, fmt.Sprintf("insights[%d].category %q is not one of %s", i, insight.Category, strings.Join(Categories, ", ")))
+		}
+		if !contains(Severities, insight.Severity) {
+			problems = append(problems, fmt.Sprintf("insights[%d].severity %q is not one of %s", i, insight.Severity, strings.Join(Severities, ", ")))
+		}
+		if strings.TrimSpace(insight.Title) == "" {
+			problems = append(problems, fmt.Sprintf("insights[%d].title is empty", i))
+		}
+		if strings.TrimSpace(insight.Description) == "" {
+			problems = append(problems, fmt.Sprintf("insights[%d].description is empty", i))
+		}
+		if insight.ScreenshotIndex < 0 || insight.ScreenshotIndex >= screenshotCount {
+			problems = append(problems, fmt.Sprintf("insights[%d].screenshotIndex %d is out of range 0-%d", i, insight.ScreenshotIndex, screenshotCount-1))
+		}
+		if box := insight.BoundingBox; box != nil && (box.X < 0 || box.Y < 0 || box.Width <= 0 || box.Height <= 0) {
+			problems = append(problems, fmt.Sprintf("insights[%d].boundingBox must have non-negative coordinates and a positive size", i))
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// ValidationError lists every schema violation found in a report
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "schema violation: " + strings.Join(e.Problems, "; ")
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package analyze
+
+import (
+	"Insightify-backend/internal/analyze/llm"
+	"Insightify-backend/internal/analyze/scraper"
+	"Insightify-backend/internal/analyze/session"
+	"Insightify-backend/internal/blobstore"
+	"Insightify-backend/internal/browser"
+	"Insightify-backend/internal/jobs"
+	"Insightify-backend/internal/progress"
+	"Insightify-backend/internal/services"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// JobRunner executes capture jobs, either queued for the worker or inline in the API process
+type JobRunner struct {
+	analysisService *services.AnalysisService
+	progress        progress.Publisher
+	cancels         jobs.Canceller
+	browsers        *browser.Pool
+	blobs           blobstore.BlobStore
+	// sealer opens the sessions of authenticated captures, nil without CAPTURE_SECRETS_KEY
+	sealer *session.Sealer
+}
+
+func NewJobRunner(analysisService *services.AnalysisService, publisher progress.Publisher, canceller jobs.Canceller, browsers *browser.Pool, blobs blobstore.BlobStore) *JobRunner {
+	sealer, err := session.NewSealerFromEnv()
+	if err != nil && !errors.Is(err, session.ErrNoKey) {
+		log.Printf("Authenticated captures are disabled: %v", err)
+	}
+	return &JobRunner{
+		sealer:          sealer,
+		blobs:           blobs,
+		analysisService: analysisService,
+		progress:        publisher,
+		cancels:         canceller,
+		browsers:        browsers,
+	}
+}
+
+// Run captures and analyzes the page of the job until it finishes or is cancelled
+func (r *JobRunner) Run(ctx context.Context, job jobs.CaptureJob) error {
+	analysis, err := r.analysisService.GetAnalysisByID(ctx, job.AnalysisID)
+	if err != nil {
+		return fmt.Errorf("error loading analysis %d: %v", job.AnalysisID, err)
+	}
+
+	// The provider is validated before the job is created, this only fails on misconfigured workers
+	provider, err := llm.NewProvider(job.Provider, job.Model)
+	scraperInstance := scraper.NewScraper(r.blobs, r.browsers, provider, r.analysisService, r.progress, job.ID)
+	if err != nil {
+		scraperInstance.FailAnalysis(analysis, err.Error())
+		scraperInstance.Finish(analysis)
+		return err
+	}
+
+	// Image options and device profiles are resolved when the job is created
+	scraperInstance.Image = job.Image
+	scraperInstance.KeepBanners = job.KeepBanners
+	scraperInstance.Steps = job.Steps
+	if job.Session != "" {
+		if r.sealer == nil {
+			err = errors.New("authenticated captures are not configured on this worker")
+		} else {
+			var opened session.Session
+			if opened, err = r.sealer.Open(job.Session); err == nil {
+				scraperInstance.Session = &opened
+			}
+		}
+		if err != nil {
+			scraperInstance.FailAnalysis(analysis, "Failed to open the capture session")
+			scraperInstance.Finish(analysis)
+			return err
+		}
+	}
+
+	ctx, release := r.cancels.Context(ctx, job.ID)
+	defer release()
+
+	scraperInstance.CaptureAndUpload(ctx, analysis, job.Devices)
+	scraperInstance.Finish(analysis)
+	return nil
+}
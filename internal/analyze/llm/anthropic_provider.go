@@ -0,0 +1,282 @@
+package llm
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/go-resty/resty/v2"
+)
+
+const (
+	anthropicEndpoint     = "https://api.anthropic.com/v1/messages"
+	anthropicVersion      = "2023-06-01"
+	defaultAnthropicModel = "claude-3-5-sonnet-latest"
+)
+
+type anthropicImageSource struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+type anthropicContent struct {
+	Type   string                `json:"type"`
+	Text   string                `json:"text,omitempty"`
+	Source *anthropicImageSource `json:"source,omitempty"`
+	Name   string                `json:"name,omitempty"`
+	Input  json.RawMessage       `json:"input,omitempty"`
+}
+
+// anthropicTool is used to get schema constrained output, the model is forced
+// to call the tool and its input is the structured response
+type anthropicTool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	InputSchema map[string]interface{} `json:"input_schema"`
+}
+
+type anthropicToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+type anthropicMessage struct {
+	Role    string             `json:"role"`
+	Content []anthropicContent `json:"content"`
+}
+
+type anthropicRequest struct {
+	Model      string               `json:"model"`
+	System     string               `json:"system,omitempty"`
+	Messages   []anthropicMessage   `json:"messages"`
+	MaxTokens  int                  `json:"max_tokens"`
+	Tools      []anthropicTool      `json:"tools,omitempty"`
+	ToolChoice *anthropicToolChoice `json:"tool_choice,omitempty"`
+	Stream     bool                 `json:"stream,omitempty"`
+}
+
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+type anthropicError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+type anthropicResponse struct {
+	Content []anthropicContent `json:"content"`
+	Usage   anthropicUsage     `json:"usage"`
+	Error   *anthropicError    `json:"error,omitempty"`
+}
+
+// anthropicStreamEvent covers the fields used from message_start,
+// content_block_delta, message_delta and error events
+type anthropicStreamEvent struct {
+	Type    string `json:"type"`
+	Message struct {
+		Usage anthropicUsage `json:"usage"`
+	} `json:"message"`
+	Delta struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+	} `json:"delta"`
+	Usage *anthropicUsage `json:"usage"`
+	Error *anthropicError `json:"error"`
+}
+
+// AnthropicProvider talks to the Anthropic Messages API
+type AnthropicProvider struct {
+	apiKey string
+	model  string
+	http   *resty.Client
+}
+
+func NewAnthropicProvider(model string) *AnthropicProvider {
+	if model == "" {
+		model = envOrDefault("ANTHROPIC_MODEL", defaultAnthropicModel)
+	}
+	return &AnthropicProvider{
+		apiKey: os.Getenv("ANTHROPIC_API_KEY"),
+		model:  model,
+		http:   resty.New(),
+	}
+}
+
+func (p *AnthropicProvider) Name() string {
+	return ProviderAnthropic
+}
+
+func (p *AnthropicProvider) Model() string {
+	return p.model
+}
+
+func (p *AnthropicProvider) Complete(ctx context.Context, request Request) (*Response, error) {
+	resp, err := p.http.R().
+		SetContext(ctx).
+		SetHeader("x-api-key", p.apiKey).
+		SetHeader("anthropic-version", anthropicVersion).
+		SetHeader("Content-Type", "application/json").
+		SetBody(p.toAnthropicRequest(request)).
+		Post(anthropicEndpoint)
+	if err != nil {
+		log.Printf("Error sending request to Anthropic: %v", err)
+		return nil, fmt.Errorf("error sending request to Anthropic: %v", err)
+	}
+
+	var data anthropicResponse
+	if err := json.Unmarshal(resp.Body(), &data); err != nil {
+		log.Printf("Error decoding Anthropic response: %v", err)
+		return nil, fmt.Errorf("error decoding JSON response: %v", err)
+	}
+
+	if data.Error != nil {
+		log.Printf("Anthropic returned an error: %s", data.Error.Message)
+		return nil, fmt.Errorf("API error: %s: %s", data.Error.Type, data.Error.Message)
+	}
+
+	var text strings.Builder
+	for _, content := range data.Content {
+		switch content.Type {
+		case "text":
+			text.WriteString(content.Text)
+		case "tool_use":
+			text.Write(content.Input)
+		}
+	}
+	if text.Len() == 0 {
+		return nil, fmt.Errorf("no text content returned")
+	}
+
+	return &Response{Text: text.String(), Provider: p.Name(), Model: p.model, Usage: data.Usage.toUsage()}, nil
+}
+
+func (p *AnthropicProvider) Stream(ctx context.Context, request Request, onDelta func(string)) (*Response, error) {
+	body := p.toAnthropicRequest(request)
+	body.Stream = true
+
+	resp, err := p.http.R().
+		SetContext(ctx).
+		SetDoNotParseResponse(true).
+		SetHeader("x-api-key", p.apiKey).
+		SetHeader("anthropic-version", anthropicVersion).
+		SetHeader("Content-Type", "application/json").
+		SetHeader("Accept", "text/event-stream").
+		SetBody(body).
+		Post(anthropicEndpoint)
+	if err != nil {
+		log.Printf("Error sending streaming request to Anthropic: %v", err)
+		return nil, fmt.Errorf("error sending request to Anthropic: %v", err)
+	}
+	raw := resp.RawBody()
+	defer raw.Close()
+
+	if resp.StatusCode() >= 400 {
+		data, _ := io.ReadAll(raw)
+		log.Printf("Anthropic returned an error: %s", data)
+		return nil, fmt.Errorf("API error: %s: %s", resp.Status(), data)
+	}
+
+	var text strings.Builder
+	var usage anthropicUsage
+
+	scanner := bufio.NewScanner(raw)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+
+		var event anthropicStreamEvent
+		if err := json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(line, "data:"))), &event); err != nil {
+			log.Printf("Error decoding Anthropic stream event: %v", err)
+			return nil, fmt.Errorf("error decoding stream event: %v", err)
+		}
+
+		switch event.Type {
+		case "message_start":
+			usage.InputTokens = event.Message.Usage.InputTokens
+		case "content_block_delta":
+			delta := event.Delta.Text
+			if event.Delta.Type == "input_json_delta" {
+				delta = event.Delta.PartialJSON
+			}
+			if delta != "" {
+				text.WriteString(delta)
+				onDelta(delta)
+			}
+		case "message_delta":
+			if event.Usage != nil {
+				usage.OutputTokens = event.Usage.OutputTokens
+			}
+		case "error":
+			if event.Error != nil {
+				return nil, fmt.Errorf("API error: %s: %s", event.Error.Type, event.Error.Message)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading stream: %v", err)
+	}
+
+	return &Response{Text: text.String(), Provider: p.Name(), Model: p.model, Usage: usage.toUsage()}, nil
+}
+
+func (u anthropicUsage) toUsage() Usage {
+	return Usage{
+		InputTokens:  u.InputTokens,
+		OutputTokens: u.OutputTokens,
+		TotalTokens:  u.InputTokens + u.OutputTokens,
+	}
+}
+
+// toAnthropicRequest moves system messages into the top level system field,
+// which is where the Messages API expects them
+func (p *AnthropicProvider) toAnthropicRequest(request Request) anthropicRequest {
+	var system []string
+	messages := make([]anthropicMessage, 0, len(request.Messages))
+
+	for _, msg := range request.Messages {
+		if msg.Role == RoleSystem {
+			for _, part := range msg.Parts {
+				system = append(system, part.Text)
+			}
+			continue
+		}
+
+		content := make([]anthropicContent, 0, len(msg.Parts))
+		for _, part := range msg.Parts {
+			switch part.Type {
+			case PartImage:
+				content = append(content, anthropicContent{Type: "image", Source: &anthropicImageSource{Type: "url", URL: part.ImageURL}})
+			default:
+				content = append(content, anthropicContent{Type: "text", Text: part.Text})
+			}
+		}
+		messages = append(messages, anthropicMessage{Role: msg.Role, Content: content})
+	}
+
+	anthropicReq := anthropicRequest{
+		Model:     p.model,
+		System:    strings.Join(system, "\n\n"),
+		Messages:  messages,
+		MaxTokens: request.MaxTokens,
+	}
+	if request.Schema != nil {
+		anthropicReq.Tools = []anthropicTool{{
+			Name:        request.Schema.Name,
+			Description: "Report the result in this structure",
+			InputSchema: request.Schema.Schema,
+		}}
+		anthropicReq.ToolChoice = &anthropicToolChoice{Type: "tool", Name: request.Schema.Name}
+	}
+	return anthropicReq
+}
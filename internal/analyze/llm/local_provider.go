@@ -0,0 +1,119 @@
+package llm
+
+import (
+	"Insightify-backend/internal/analyze/openai"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const (
+	defaultLocalBaseURL = "http://localhost:11434/v1"
+	defaultLocalModel   = "llava"
+)
+
+// LocalProvider targets an OpenAI compatible server such as Ollama or vLLM
+type LocalProvider struct {
+	client       *openai.Client
+	model        string
+	inlineImages bool
+}
+
+func NewLocalProvider(model string) *LocalProvider {
+	if model == "" {
+		model = envOrDefault("LOCAL_LLM_MODEL", defaultLocalModel)
+	}
+	baseURL := strings.TrimSuffix(envOrDefault("LOCAL_LLM_BASE_URL", defaultLocalBaseURL), "/")
+
+	return &LocalProvider{
+		client: openai.NewClient(baseURL+"/chat/completions", os.Getenv("LOCAL_LLM_API_KEY")),
+		model:  model,
+		// Ollama only accepts base64 images, so remote URLs have to be inlined
+		inlineImages: os.Getenv("LOCAL_LLM_INLINE_IMAGES") == "true",
+	}
+}
+
+func (p *LocalProvider) Name() string {
+	return ProviderLocal
+}
+
+func (p *LocalProvider) Model() string {
+	return p.model
+}
+
+func (p *LocalProvider) Complete(ctx context.Context, request Request) (*Response, error) {
+	if p.inlineImages {
+		var err error
+		if request, err = inlineImageParts(ctx, request); err != nil {
+			return nil, err
+		}
+	}
+
+	text, err := p.client.SendPrompt(ctx, toGPTRequest(p.model, request))
+	if err != nil {
+		return nil, err
+	}
+	return &Response{Text: text, Provider: p.Name(), Model: p.model}, nil
+}
+
+func (p *LocalProvider) Stream(ctx context.Context, request Request, onDelta func(string)) (*Response, error) {
+	if p.inlineImages {
+		var err error
+		if request, err = inlineImageParts(ctx, request); err != nil {
+			return nil, err
+		}
+	}
+	return streamGPT(ctx, p.client, p.Name(), p.model, request, onDelta)
+}
+
+// inlineImageParts downloads every image part and replaces its URL with a data URL
+func inlineImageParts(ctx context.Context, request Request) (Request, error) {
+	messages := make([]Message, len(request.Messages))
+	for i, msg := range request.Messages {
+		parts := make([]Part, len(msg.Parts))
+		for j, part := range msg.Parts {
+			if part.Type == PartImage && !strings.HasPrefix(part.ImageURL, "data:") {
+				dataURL, err := fetchAsDataURL(ctx, part.ImageURL)
+				if err != nil {
+					return request, err
+				}
+				part.ImageURL = dataURL
+			}
+			parts[j] = part
+		}
+		messages[i] = Message{Role: msg.Role, Parts: parts}
+	}
+	request.Messages = messages
+	return request, nil
+}
+
+func fetchAsDataURL(ctx context.Context, url string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error downloading image %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("error downloading image %s: %s", url, resp.Status)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("error reading image %s: %v", url, err)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	return "data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(data), nil
+}
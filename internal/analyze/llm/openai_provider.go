@@ -0,0 +1,95 @@
+package llm
+
+import (
+	"Insightify-backend/internal/analyze/openai"
+	"context"
+	"os"
+)
+
+const defaultOpenAIModel = "gpt-4o"
+
+type OpenAIProvider struct {
+	client *openai.Client
+	model  string
+}
+
+func NewOpenAIProvider(model string) *OpenAIProvider {
+	if model == "" {
+		model = envOrDefault("OPENAI_MODEL", defaultOpenAIModel)
+	}
+	return &OpenAIProvider{
+		client: openai.NewClient(openai.APIEndpoint, os.Getenv("OPENAI_API_KEY")),
+		model:  model,
+	}
+}
+
+func (p *OpenAIProvider) Name() string {
+	return ProviderOpenAI
+}
+
+func (p *OpenAIProvider) Model() string {
+	return p.model
+}
+
+func (p *OpenAIProvider) Complete(ctx context.Context, request Request) (*Response, error) {
+	text, err := p.client.SendPrompt(ctx, toGPTRequest(p.model, request))
+	if err != nil {
+		return nil, err
+	}
+	return &Response{Text: text, Provider: p.Name(), Model: p.model}, nil
+}
+
+func (p *OpenAIProvider) Stream(ctx context.Context, request Request, onDelta func(string)) (*Response, error) {
+	return streamGPT(ctx, p.client, p.Name(), p.model, request, onDelta)
+}
+
+func streamGPT(ctx context.Context, client *openai.Client, provider string, model string, request Request, onDelta func(string)) (*Response, error) {
+	text, usage, err := client.StreamPrompt(ctx, toGPTRequest(model, request), onDelta)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &Response{Text: text, Provider: provider, Model: model}
+	if usage != nil {
+		response.Usage = Usage{
+			InputTokens:  usage.PromptTokens,
+			OutputTokens: usage.CompletionTokens,
+			TotalTokens:  usage.TotalTokens,
+		}
+	}
+	return response, nil
+}
+
+// toGPTRequest converts a provider agnostic request into the chat completions shape
+func toGPTRequest(model string, request Request) openai.GPTRequest {
+	messages := make([]openai.Message, 0, len(request.Messages))
+	for _, msg := range request.Messages {
+		content := make([]openai.Content, 0, len(msg.Parts))
+		for _, part := range msg.Parts {
+			switch part.Type {
+			case PartImage:
+				content = append(content, openai.Content{Type: "image_url", ImageURL: &openai.ImageURL{URL: part.ImageURL, Detail: "high"}})
+			default:
+				content = append(content, openai.Content{Type: "text", Text: part.Text})
+			}
+		}
+		messages = append(messages, openai.Message{Role: msg.Role, Content: content})
+	}
+
+	gptRequest := openai.GPTRequest{
+		Model:     model,
+		Messages:  messages,
+		MaxTokens: request.MaxTokens,
+	}
+	if request.Schema != nil {
+		gptRequest.ResponseFormat = &openai.ResponseFormat{
+			Type: "json_schema",
+			JSONSchema: &openai.JSONSchema{
+				Name:   request.Schema.Name,
+				Strict: true,
+				Schema: request.Schema.Schema,
+			},
+		}
+	}
+	return gptRequest
+}
@@ -0,0 +1,106 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	ProviderOpenAI    = "openai"
+	ProviderAnthropic = "anthropic"
+	ProviderLocal     = "local"
+)
+
+const (
+	PartText  = "text"
+	PartImage = "image"
+)
+
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// LLMProvider is a vision capable chat model backend
+type LLMProvider interface {
+	Name() string
+	Model() string
+	Complete(ctx context.Context, request Request) (*Response, error)
+	// Stream behaves like Complete but calls onDelta for every text token as it arrives
+	Stream(ctx context.Context, request Request, onDelta func(string)) (*Response, error)
+}
+
+// Part is a single piece of message content, either text or an image URL
+type Part struct {
+	Type     string
+	Text     string
+	ImageURL string
+}
+
+type Message struct {
+	Role  string
+	Parts []Part
+}
+
+// ResponseSchema asks the provider to constrain its output to a JSON schema
+type ResponseSchema struct {
+	Name   string
+	Schema map[string]interface{}
+}
+
+type Request struct {
+	Messages  []Message
+	MaxTokens int
+	Schema    *ResponseSchema
+}
+
+type Usage struct {
+	InputTokens  int `json:"inputTokens"`
+	OutputTokens int `json:"outputTokens"`
+	TotalTokens  int `json:"totalTokens"`
+}
+
+type Response struct {
+	Text     string
+	Provider string
+	Model    string
+	Usage    Usage
+}
+
+func TextPart(text string) Part {
+	return Part{Type: PartText, Text: text}
+}
+
+func ImagePart(url string) Part {
+	return Part{Type: PartImage, ImageURL: url}
+}
+
+// NewProvider returns the provider registered under name, falling back to the
+// LLM_PROVIDER environment variable and then OpenAI. An empty model selects
+// the provider default.
+func NewProvider(name string, model string) (LLMProvider, error) {
+	if name == "" {
+		name = os.Getenv("LLM_PROVIDER")
+	}
+
+	switch strings.ToLower(name) {
+	case "", ProviderOpenAI:
+		return NewOpenAIProvider(model), nil
+	case ProviderAnthropic:
+		return NewAnthropicProvider(model), nil
+	case ProviderLocal, "ollama", "vllm":
+		return NewLocalProvider(model), nil
+	default:
+		return nil, fmt.Errorf("unknown LLM provider: %s", name)
+	}
+}
+
+func envOrDefault(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
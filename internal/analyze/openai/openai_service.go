@@ -1,6 +1,7 @@
 package openai
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -10,15 +11,18 @@ import (
 )
 
 const (
-	apiEndpoint = "https://api.openai.com/v1/chat/completions"
+	APIEndpoint = "https://api.openai.com/v1/chat/completions"
 )
 
+type ImageURL struct {
+	URL    string `json:"url"`
+	Detail string `json:"detail,omitempty"`
+}
+
 type Content struct {
-	Type     string `json:"type"`
-	Text     string `json:"text,omitempty"`
-	ImageURL struct {
-		URL string `json:"url"`
-	} `json:"image_url,omitempty"`
+	Type     string    `json:"type"`
+	Text     string    `json:"text,omitempty"`
+	ImageURL *ImageURL `json:"image_url,omitempty"`
 }
 
 type Message struct {
@@ -26,29 +30,66 @@ type Message struct {
 	Content []Content `json:"content"`
 }
 
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type JSONSchema struct {
+	Name   string                 `json:"name"`
+	Strict bool                   `json:"strict"`
+	Schema map[string]interface{} `json:"schema"`
+}
+
+// ResponseFormat requests structured outputs matching a JSON schema
+type ResponseFormat struct {
+	Type       string      `json:"type"`
+	JSONSchema *JSONSchema `json:"json_schema,omitempty"`
+}
+
 type GPTRequest struct {
-	Model     string    `json:"model"`
-	Messages  []Message `json:"messages"`
-	MaxTokens int       `json:"max_tokens"`
+	Model          string          `json:"model"`
+	Messages       []Message       `json:"messages"`
+	MaxTokens      int             `json:"max_tokens"`
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+	Stream         bool            `json:"stream,omitempty"`
+	StreamOptions  *StreamOptions  `json:"stream_options,omitempty"`
+}
+
+// Client talks to an OpenAI compatible chat completions endpoint
+type Client struct {
+	endpoint string
+	apiKey   string
+	http     *resty.Client
+}
+
+func NewClient(endpoint, apiKey string) *Client {
+	return &Client{
+		endpoint: endpoint,
+		apiKey:   apiKey,
+		http:     resty.New(),
+	}
 }
 
 func SendPromptToGPT(request GPTRequest) (string, error) {
-	apiKey := os.Getenv("OPENAI_API_KEY")
-	client := resty.New()
+	client := NewClient(APIEndpoint, os.Getenv("OPENAI_API_KEY"))
+	return client.SendPrompt(context.Background(), request)
+}
 
-	resp, err := client.R().
-		SetAuthToken(apiKey).
+func (c *Client) SendPrompt(ctx context.Context, request GPTRequest) (string, error) {
+	req := c.http.R().
+		SetContext(ctx).
 		SetHeader("Content-Type", "application/json").
-		SetBody(request).
-		Post(apiEndpoint)
+		SetBody(request)
+	if c.apiKey != "" {
+		req.SetAuthToken(c.apiKey)
+	}
+
+	resp, err := req.Post(c.endpoint)
 	if err != nil {
 		log.Printf("Error sending request to OpenAI: %v", err)
 		return "", fmt.Errorf("error sending request to OpenAI: %v", err)
 	}
 
-	// Log the full response for debugging
-	log.Printf("Full API response: %s", resp.String())
-
 	var data map[string]interface{}
 	if err := json.Unmarshal(resp.Body(), &data); err != nil {
 		log.Printf("Error decoding JSON response: %v", err)
@@ -79,6 +120,5 @@ func SendPromptToGPT(request GPTRequest) (string, error) {
 		return "", fmt.Errorf("content field missing or not a string")
 	}
 
-	log.Println("Received content:", content)
 	return content, nil
 }
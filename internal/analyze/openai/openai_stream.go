@@ -0,0 +1,101 @@
+package openai
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+)
+
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type streamChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+	} `json:"choices"`
+	Usage *Usage `json:"usage"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// StreamPrompt sends the request with stream enabled and calls onDelta for
+// every content token received. It returns the full text and the usage stats
+// reported in the final chunk.
+func (c *Client) StreamPrompt(ctx context.Context, request GPTRequest, onDelta func(string)) (string, *Usage, error) {
+	request.Stream = true
+	request.StreamOptions = &StreamOptions{IncludeUsage: true}
+
+	req := c.http.R().
+		SetContext(ctx).
+		SetDoNotParseResponse(true).
+		SetHeader("Content-Type", "application/json").
+		SetHeader("Accept", "text/event-stream").
+		SetBody(request)
+	if c.apiKey != "" {
+		req.SetAuthToken(c.apiKey)
+	}
+
+	resp, err := req.Post(c.endpoint)
+	if err != nil {
+		log.Printf("Error sending streaming request to OpenAI: %v", err)
+		return "", nil, fmt.Errorf("error sending request to OpenAI: %v", err)
+	}
+	body := resp.RawBody()
+	defer body.Close()
+
+	if resp.StatusCode() >= 400 {
+		data, _ := io.ReadAll(body)
+		log.Printf("API returned an error: %s", data)
+		return "", nil, fmt.Errorf("API error: %s: %s", resp.Status(), data)
+	}
+
+	var text strings.Builder
+	var usage *Usage
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			break
+		}
+
+		var chunk streamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			log.Printf("Error decoding stream chunk: %v", err)
+			return text.String(), usage, fmt.Errorf("error decoding stream chunk: %v", err)
+		}
+		if chunk.Error != nil {
+			return text.String(), usage, fmt.Errorf("API error: %s", chunk.Error.Message)
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+		for _, choice := range chunk.Choices {
+			if choice.Delta.Content == "" {
+				continue
+			}
+			text.WriteString(choice.Delta.Content)
+			onDelta(choice.Delta.Content)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return text.String(), usage, fmt.Errorf("error reading stream: %v", err)
+	}
+
+	return text.String(), usage, nil
+}
@@ -0,0 +1,179 @@
+package scraper
+
+import (
+	"Insightify-backend/internal/analyze/insights"
+	"Insightify-backend/internal/analyze/llm"
+	"Insightify-backend/internal/database/models"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	analysisMaxTokens = 4096
+	// maxPromptHTMLLength keeps the extracted markup within the model context window
+	maxPromptHTMLLength = 60000
+	// maxSchemaRetries is how many times the model is asked to fix an invalid report
+	maxSchemaRetries = 2
+)
+
+const analysisSystemPrompt = `You are a senior UX and visual design reviewer.
+You receive full-page screenshots of a website, captured top to bottom, each followed by the HTML of the elements
+it shows with their boxes in that screenshot's pixels, so you can relate markup to what you see.
+Fixed and sticky elements such as navigation bars may be left out of later screenshots because an earlier one shows
+them, the screenshot's label names them. Do not report them as missing.
+The page may have been captured on several devices, compare them to find responsive layout issues.
+Review the page for usability, accessibility, visual hierarchy, layout, typography, color and content issues.
+Respond only with a JSON object matching the insight_report schema. For every finding set screenshotIndex to the
+zero based index of the screenshot it appears in, boundingBox to its region in that screenshot's pixels (or null
+when it applies to the whole page), and explain what is wrong and how to fix it.`
+
+// AnalysisDone is the content of the final analysis_done message
+type AnalysisDone struct {
+	Provider string    `json:"provider"`
+	Model    string    `json:"model"`
+	Usage    llm.Usage `json:"usage"`
+	Attempts int       `json:"attempts"`
+}
+
+// AnalysisReset is the content of the analysis_reset message sent before a
+// retry, the analysis_delta output received so far is to be discarded
+type AnalysisReset struct {
+	Attempt int `json:"attempt"`
+}
+
+// analyzeCapture sends the uploaded screenshots and extracted HTML to the LLM,
+// relays the output token by token over the WebSocket and validates the
+// resulting report, asking the model to correct it on schema violations
+func (s *Scraper) analyzeCapture(ctx context.Context, screenshots []capturedScreenshot, html string) (*insights.Report, llm.Usage, error) {
+	s.sendProgress(WebSocketMessage{Type: "status", Content: "Generating insights"})
+
+	request := buildAnalysisRequest(screenshots, html)
+	var usage llm.Usage
+
+	for attempt := 1; attempt <= maxSchemaRetries+1; attempt++ {
+		if attempt > 1 {
+			// The deltas of the rejected attempt have been relayed already, the client discards them
+			s.sendProgress(WebSocketMessage{Type: "analysis_reset", Content: AnalysisReset{Attempt: attempt}})
+		}
+		response, err := s.LLM.Stream(ctx, request, func(delta string) {
+			s.sendProgress(WebSocketMessage{Type: "analysis_delta", Content: delta})
+		})
+		if err != nil {
+			log.Printf("Failed to analyze capture with %s: %v", s.LLM.Name(), err)
+			if ctx.Err() == nil {
+				s.sendProgress(WebSocketMessage{Type: "error", Content: "Failed to generate insights"})
+			}
+			return nil, usage, err
+		}
+		usage.InputTokens += response.Usage.InputTokens
+		usage.OutputTokens += response.Usage.OutputTokens
+		usage.TotalTokens += response.Usage.TotalTokens
+
+		report, err := insights.Parse(response.Text, len(screenshots))
+		if err == nil {
+			s.sendProgress(WebSocketMessage{Type: "analysis", Content: report})
+			s.sendProgress(WebSocketMessage{Type: "analysis_done", Content: AnalysisDone{
+				Provider: response.Provider,
+				Model:    response.Model,
+				Usage:    usage,
+				Attempts: attempt,
+			}})
+			return report, usage, nil
+		}
+
+		log.Printf("Attempt %d returned an invalid insight report: %v", attempt, err)
+		if attempt <= maxSchemaRetries {
+			s.sendProgress(WebSocketMessage{Type: "status", Content: "Insights did not match the expected format, retrying"})
+			request.Messages = append(request.Messages,
+				llm.Message{Role: llm.RoleAssistant, Parts: []llm.Part{llm.TextPart(response.Text)}},
+				llm.Message{Role: llm.RoleUser, Parts: []llm.Part{llm.TextPart(schemaCorrectionPrompt(err))}},
+			)
+		}
+	}
+
+	s.sendProgress(WebSocketMessage{Type: "error", Content: "Failed to generate insights in the expected format"})
+	return nil, usage, errors.New("insight report did not match the schema")
+}
+
+func schemaCorrectionPrompt(err error) string {
+	var validationErr *insights.ValidationError
+	if errors.As(err, &validationErr) {
+		return "The report is invalid:\n- " + strings.Join(validationErr.Problems, "\n- ") + "\nReturn the corrected JSON report only."
+	}
+	return fmt.Sprintf("The report could not be parsed (%v). Return only the JSON report.", err)
+}
+
+// buildAnalysisRequest assembles the vision prompt with one image part per
+// screenshot, labelled with the device it was taken with and followed by the
+// markup of the elements it shows. The full page HTML is only sent when no
+// screenshot has its elements.
+func buildAnalysisRequest(screenshots []capturedScreenshot, html string) llm.Request {
+	segmented := false
+	for _, screenshot := range screenshots {
+		if len(screenshot.Elements) > 0 {
+			segmented = true
+			break
+		}
+	}
+
+	parts := []llm.Part{
+		llm.TextPart(fmt.Sprintf("Here are %d screenshots of the page in scroll order, grouped by the device they were taken with.", len(screenshots))),
+	}
+	for i, screenshot := range screenshots {
+		device := screenshot.Device
+		parts = append(parts,
+			llm.TextPart(fmt.Sprintf("Screenshot %d (%s, %dx%d viewport at %gx scale)%s%s:", i, device.Name, device.Width, device.Height, device.DeviceScaleFactor, stepNote(screenshot.Step), hiddenNote(screenshot.Hidden))),
+			llm.ImagePart(screenshot.URL),
+		)
+		if segment := formatElements(screenshot.Elements, maxPromptHTMLLength/len(screenshots)); segment != "" {
+			parts = append(parts, llm.TextPart(fmt.Sprintf("HTML of the elements in screenshot %d:\n%s", i, segment)))
+		}
+	}
+	if !segmented && html != "" {
+		parts = append(parts, llm.TextPart("HTML of the visible elements:\n"+truncateUTF8(html, maxPromptHTMLLength)))
+	}
+
+	return llm.Request{
+		Messages: []llm.Message{
+			{Role: llm.RoleSystem, Parts: []llm.Part{llm.TextPart(analysisSystemPrompt)}},
+			{Role: llm.RoleUser, Parts: parts},
+		},
+		MaxTokens: analysisMaxTokens,
+		Schema:    &llm.ResponseSchema{Name: insights.SchemaName, Schema: insights.Schema()},
+	}
+}
+
+// hiddenNote names the fixed elements left out of a screenshot for the screenshot's label
+func hiddenNote(hidden []models.HiddenElement) string {
+	if len(hidden) == 0 {
+		return ""
+	}
+	selectors := make([]string, 0, len(hidden))
+	for _, element := range hidden {
+		selectors = append(selectors, element.Selector)
+	}
+	return ", without the fixed elements " + strings.Join(selectors, ", ")
+}
+
+// stepNote names the scripted step a screenshot was taken at for the screenshot's label
+func stepNote(step string) string {
+	if step == "" {
+		return ""
+	}
+	return ", taken at scripted " + step + " before the page capture"
+}
+
+// truncateUTF8 cuts s to at most maxBytes bytes without splitting a rune
+func truncateUTF8(s string, maxBytes int) string {
+	if len(s) <= maxBytes {
+		return s
+	}
+	for maxBytes > 0 && !utf8.RuneStart(s[maxBytes]) {
+		maxBytes--
+	}
+	return s[:maxBytes]
+}
@@ -0,0 +1,122 @@
+package scraper
+
+import (
+	"Insightify-backend/internal/database/models"
+	"context"
+	"log"
+	"os"
+
+	"github.com/chromedp/chromedp"
+)
+
+// FixedElementOptions control how fixed and sticky elements, such as navbars
+// and chat widgets, are treated in captures made of several viewport frames.
+// Hidden elements only appear in the first frame, so they are not reviewed
+// once per screenshot.
+type FixedElementOptions struct {
+	Hide bool
+	// RestoreLast shows the hidden elements again in the last frame, for footers and bottom bars
+	RestoreLast bool
+}
+
+// FixedElementOptionsFromEnv reads HIDE_FIXED_ELEMENTS (on unless "false") and RESTORE_FIXED_ON_LAST (off unless "true")
+func FixedElementOptionsFromEnv() FixedElementOptions {
+	return FixedElementOptions{
+		Hide:        os.Getenv("HIDE_FIXED_ELEMENTS") != "false",
+		RestoreLast: os.Getenv("RESTORE_FIXED_ON_LAST") == "true",
+	}
+}
+
+// hideFixedScript hides the visible fixed elements and the sticky elements
+// that are stuck to an edge of the viewport, skipping full viewport
+// backgrounds. The inline visibility of each element is kept in an attribute
+// for restoring it.
+const hideFixedScript = `(() => {
+	const describe = (el) => {
+		let description = el.tagName.toLowerCase();
+		if (el.id) {
+			description += '#' + el.id;
+		}
+		const classes = Array.from(el.classList).slice(0, 3);
+		if (classes.length > 0) {
+			description += '.' + classes.join('.');
+		}
+		return description;
+	};
+
+	const hidden = [];
+	for (const el of document.body.querySelectorAll('*')) {
+		if (el.closest('[data-insightify-hidden]')) {
+			continue;
+		}
+		const style = window.getComputedStyle(el);
+		if ((style.position !== 'fixed' && style.position !== 'sticky') || style.display === 'none' || style.visibility === 'hidden') {
+			continue;
+		}
+		const rect = el.getBoundingClientRect();
+		if (rect.width === 0 || rect.height === 0 || rect.bottom <= 0 || rect.top >= window.innerHeight) {
+			continue;
+		}
+		if (rect.width >= window.innerWidth * 0.9 && rect.height >= window.innerHeight * 0.9) {
+			continue;
+		}
+		if (style.position === 'sticky') {
+			const stuckTop = Math.abs(rect.top - (parseFloat(style.top) || 0)) < 1;
+			const stuckBottom = Math.abs(window.innerHeight - rect.bottom - (parseFloat(style.bottom) || 0)) < 1;
+			if (!stuckTop && !stuckBottom) {
+				continue;
+			}
+		}
+		el.setAttribute('data-insightify-hidden', el.style.getPropertyValue('visibility'));
+		el.style.setProperty('visibility', 'hidden', 'important');
+		hidden.push({ selector: describe(el), position: style.position });
+	}
+	return hidden;
+})()`
+
+const restoreFixedScript = `(() => {
+	for (const el of document.querySelectorAll('[data-insightify-hidden]')) {
+		const visibility = el.getAttribute('data-insightify-hidden');
+		el.style.removeProperty('visibility');
+		if (visibility) {
+			el.style.setProperty('visibility', visibility);
+		}
+		el.removeAttribute('data-insightify-hidden');
+	}
+})()`
+
+// hideFixedElements hides the fixed and sticky elements currently shown and
+// returns them, elements hidden before are not reported again
+func (s *Scraper) hideFixedElements(ctx context.Context) []models.HiddenElement {
+	var hidden []models.HiddenElement
+	if err := chromedp.Run(ctx, chromedp.Evaluate(hideFixedScript, &hidden)); err != nil {
+		if ctx.Err() == nil {
+			log.Printf("Failed to hide fixed elements: %v", err)
+		}
+		return nil
+	}
+	return hidden
+}
+
+// restoreFixedElements shows the elements hidden by hideFixedElements again
+func (s *Scraper) restoreFixedElements(ctx context.Context) {
+	if err := chromedp.Run(ctx, chromedp.Evaluate(restoreFixedScript, nil)); err != nil && ctx.Err() == nil {
+		log.Printf("Failed to restore fixed elements: %v", err)
+	}
+}
+
+// fixedElementsFor prepares the frame at index of a capture of count frames
+// and returns the elements hidden in it. hidden accumulates the elements
+// hidden so far and is reset when they are restored for the last frame.
+func (s *Scraper) fixedElementsFor(ctx context.Context, index int, count int, hidden *[]models.HiddenElement) []models.HiddenElement {
+	if !s.Fixed.Hide || index == 0 {
+		return nil
+	}
+	if s.Fixed.RestoreLast && index == count-1 {
+		s.restoreFixedElements(ctx)
+		*hidden = nil
+		return nil
+	}
+	*hidden = append(*hidden, s.hideFixedElements(ctx)...)
+	return append([]models.HiddenElement(nil), *hidden...)
+}
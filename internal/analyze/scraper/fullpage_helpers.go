@@ -0,0 +1,126 @@
+package scraper
+
+import (
+	"Insightify-backend/internal/analyze/devices"
+	"Insightify-backend/internal/analyze/imaging"
+	"Insightify-backend/internal/database/models"
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+const (
+	// maxBeyondViewportHeight is the tallest page Chrome reliably renders in a single capture, in image pixels
+	maxBeyondViewportHeight = 16384
+	// maxStitchedHeight caps stitched screenshots, in image pixels, to bound memory use
+	maxStitchedHeight = 32768
+)
+
+// captureFullPage takes a single screenshot of the whole page, position is the
+// index it is stored at. Pages too tall for Chrome to render at once are
+// captured viewport by viewport and stitched together.
+func (s *Scraper) captureFullPage(ctx context.Context, analysis *models.Analysis, profile devices.Profile, position int) []capturedScreenshot {
+	s.sendProgress(WebSocketMessage{Type: "status", Content: "Full page capture has started"})
+
+	var pageHeight float64
+	if err := chromedp.Run(ctx, chromedp.Evaluate(`Math.ceil(document.documentElement.scrollHeight)`, &pageHeight)); err != nil {
+		if ctx.Err() == nil {
+			log.Printf("Failed to measure page height: %v", err)
+			s.sendProgress(WebSocketMessage{Type: "error", Content: "Error during full page capture"})
+		}
+		return nil
+	}
+
+	// Pages taller than the settle phase loaded are cut off there, which only stitching can do
+	cutOff := pageHeight > float64(s.Settle.MaxHeight)
+	pageHeight = min(pageHeight, float64(s.Settle.MaxHeight))
+
+	var screenshot []byte
+	var hidden []models.HiddenElement
+	var err error
+	if !cutOff && pageHeight*profile.DeviceScaleFactor <= maxBeyondViewportHeight {
+		err = chromedp.Run(ctx, chromedp.FullScreenshot(&screenshot, 100))
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Full page screenshot failed, stitching viewport captures instead: %v", err)
+		}
+	}
+	if screenshot == nil && ctx.Err() == nil {
+		screenshot, hidden, err = s.captureStitched(ctx, profile, int(pageHeight))
+	}
+	if err != nil || screenshot == nil {
+		if ctx.Err() == nil {
+			log.Printf("Failed to capture full page: %v", err)
+			s.sendProgress(WebSocketMessage{Type: "error", Content: "Error during full page capture"})
+		}
+		return nil
+	}
+
+	captured, ok := s.storeScreenshot(ctx, analysis, profile, frame{
+		Data:     screenshot,
+		Position: position,
+		Elements: s.extractSegment(ctx, 0, int(pageHeight)),
+		Hidden:   hidden,
+	})
+	if !ok {
+		return nil
+	}
+	s.sendProgress(WebSocketMessage{Type: "progress", Content: 100})
+	return []capturedScreenshot{captured}
+}
+
+// captureStitched scrolls through the page one viewport at a time and stitches
+// the captures at the scroll offsets the browser reports, so the overlap of the
+// last capture with the one before is accounted for. Fixed and sticky elements
+// are hidden after the first capture and returned.
+func (s *Scraper) captureStitched(ctx context.Context, profile devices.Profile, pageHeight int) ([]byte, []models.HiddenElement, error) {
+	viewportHeight := int(profile.Height)
+	scaledViewportHeight := int(float64(viewportHeight) * profile.DeviceScaleFactor)
+	height := int(float64(pageHeight) * profile.DeviceScaleFactor)
+	if height > maxStitchedHeight {
+		height = maxStitchedHeight
+		log.Printf("Page is %dpx tall, the stitched screenshot is cut off at %dpx", pageHeight, maxStitchedHeight)
+	}
+
+	// hiddenInTiles are all elements hidden in some tile, even when they are shown again in the last
+	var hidden, hiddenInTiles []models.HiddenElement
+	defer s.restoreFixedElements(ctx)
+
+	var tiles []imaging.Tile
+	capturedHeight := min(pageHeight, int(float64(height)/profile.DeviceScaleFactor))
+	count := (capturedHeight + viewportHeight - 1) / viewportHeight
+	for offset := 0; offset < pageHeight; offset += viewportHeight {
+		var scrollY float64
+		var tile []byte
+		err := chromedp.Run(ctx,
+			chromedp.Evaluate(fmt.Sprintf("window.scrollTo(0, %d);", offset), nil),
+			chromedp.Sleep(500*time.Millisecond),
+			chromedp.Evaluate(`Math.round(window.scrollY)`, &scrollY),
+		)
+		if err == nil {
+			// Sticky elements are only stuck once scrolled to
+			if hiddenInTile := s.fixedElementsFor(ctx, len(tiles), count, &hidden); len(hiddenInTile) > 0 {
+				hiddenInTiles = hiddenInTile
+			}
+			err = chromedp.Run(ctx, chromedp.CaptureScreenshot(&tile))
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to capture viewport at %d: %v", offset, err)
+		}
+
+		offsetY := int(scrollY * profile.DeviceScaleFactor)
+		tiles = append(tiles, imaging.Tile{Image: tile, OffsetY: offsetY})
+		if offsetY+scaledViewportHeight >= height {
+			break
+		}
+	}
+
+	stitched, err := imaging.Stitch(tiles, height)
+	if err != nil {
+		return nil, nil, err
+	}
+	encoded, err := imaging.EncodePNG(stitched)
+	return encoded, hiddenInTiles, err
+}
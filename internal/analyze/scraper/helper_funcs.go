@@ -1,15 +1,16 @@
 package scraper
 
 import (
+	"Insightify-backend/internal/analyze/devices"
+	"Insightify-backend/internal/database/models"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"time"
 
 	"github.com/chromedp/chromedp"
 	"github.com/chromedp/chromedp/kb"
-	"github.com/gorilla/websocket"
 )
 
 // scrollToTop attempts to scroll to the top of the page by using Home key and PageUp key.
@@ -42,48 +43,73 @@ func (s *Scraper) scrollToTop(ctx context.Context, retries int) error {
 	return fmt.Errorf("unable to scroll to the top after %d retries", retries)
 }
 
-func (s *Scraper) determineHeight(ctx context.Context) (int, error) {
-	var lastScrollY float64
-	maxRetries := 5 // Maximum number of retries
-	retryCount := 0
-	sleepTime := 1500 * time.Millisecond
-
-	// Function to scroll to the bottom of the page
-	scrollToBottom := func() error {
-		return chromedp.Run(ctx,
-			chromedp.KeyEvent(kb.End),
-			chromedp.Sleep(1500*time.Millisecond),
-			chromedp.KeyEvent(kb.PageDown),
-			chromedp.Evaluate(`Math.round(window.scrollY)`, &lastScrollY),
-		)
+// PreparePage settles the page loaded in the tab of ctx and closes the
+// overlays covering it before running the capture's steps, so the menus and
+// dialogs the steps open are still showing when the page is captured. It
+// returns the scroll position of the bottom of the page and the screenshots
+// taken by screenshot steps, errors are worded for the client.
+func (s *Scraper) PreparePage(ctx context.Context, analysis *models.Analysis, profile devices.Profile, position int) (int, []capturedScreenshot, error) {
+	lastScrollY, err := s.determineHeight(ctx)
+	if err != nil {
+		return 0, nil, errors.New("Failed to determine page height")
+	}
+	if len(s.Steps) == 0 {
+		return lastScrollY, nil, nil
 	}
 
-	// Retry mechanism
-	for retryCount < maxRetries {
-		err := scrollToBottom()
-		if err != nil {
-			fmt.Println("Failed to scroll to the bottom:", err)
-			return 0, err
-		}
-
-		if lastScrollY > 0 {
-			break
-		}
+	captured, err := s.runSteps(ctx, analysis, profile, position)
+	if err != nil {
+		return 0, captured, errors.New("Scripted " + err.Error())
+	}
+	// Steps may load another page or change its height, it is measured again
+	// without settling, dismissing overlays or scrolling
+	lastScrollY, err = s.measureHeight(ctx)
+	if err != nil {
+		return 0, captured, errors.New("Failed to determine page height")
+	}
+	return lastScrollY, captured, nil
+}
 
-		fmt.Printf("Retry %d: lastScrollY is 0, retrying...\n", retryCount+1)
-		retryCount++
-		sleepTime += 500 * time.Millisecond // Optionally increase sleep time on each retry
+// measureHeight returns the scroll position of the bottom of the page as it
+// is, capped at the maximum height of the settle options
+func (s *Scraper) measureHeight(ctx context.Context) (int, error) {
+	var page struct {
+		Height         int `json:"height"`
+		ViewportHeight int `json:"viewportHeight"`
+	}
+	err := chromedp.Run(ctx, chromedp.Evaluate(`({ height: Math.ceil(document.documentElement.scrollHeight), viewportHeight: window.innerHeight })`, &page))
+	if err != nil {
+		return 0, err
+	}
+	scrollY := min(page.Height, s.Settle.MaxHeight) - page.ViewportHeight
+	if scrollY <= 0 {
+		return 0, fmt.Errorf("failed to get a valid scroll height, the page is %dpx tall", page.Height)
 	}
+	return scrollY, nil
+}
 
-	if lastScrollY == 0 {
-		return 0, fmt.Errorf("failed to get a valid scroll height after %d retries", maxRetries)
+// determineHeight settles the page, so lazy-loaded content is in place, and
+// returns the scroll position of its bottom, capped at the maximum height of
+// the settle options. The page is scrolled back to the top afterwards.
+func (s *Scraper) determineHeight(ctx context.Context) (int, error) {
+	s.sendProgress(WebSocketMessage{Type: "status", Content: "Loading the whole page"})
+	step, report, err := s.settle(ctx)
+	if err != nil {
+		log.Printf("Failed to settle the page: %v", err)
+		return 0, err
 	}
+	s.sendProgress(WebSocketMessage{Type: "settle", Content: report})
+	// Some banners only appear once the page is scrolled
+	s.dismissOverlays(ctx)
 
-	scrollYInt := int(lastScrollY)
+	scrollYInt := min(step.Height, s.Settle.MaxHeight) - step.ViewportHeight
+	if scrollYInt <= 0 {
+		return 0, fmt.Errorf("failed to get a valid scroll height, the page is %dpx tall", step.Height)
+	}
 	fmt.Println("last scroll: ", scrollYInt)
 
 	retries := 5
-	err := s.scrollToTop(ctx, retries)
+	err = s.scrollToTop(ctx, retries)
 	if err != nil {
 		return 0, err
 	}
@@ -106,13 +132,9 @@ func (s *Scraper) determineHeight(ctx context.Context) (int, error) {
 	return scrollYInt, nil
 }
 
-func (s *Scraper) sendWebSocketMessage(conn *websocket.Conn, msg WebSocketMessage) {
-	message, err := json.Marshal(msg)
-	if err != nil {
-		log.Printf("Failed to marshal WebSocket message: %v", err)
-		return
-	}
-	if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
-		log.Printf("Failed to send WebSocket message: %v", err)
+// sendProgress publishes a progress update for the job to whoever is subscribed to it
+func (s *Scraper) sendProgress(msg WebSocketMessage) {
+	if err := s.Progress.Publish(context.Background(), s.JobID, msg); err != nil {
+		log.Printf("Failed to publish progress for job %s: %v", s.JobID, err)
 	}
 }
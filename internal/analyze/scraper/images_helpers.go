@@ -1,24 +1,35 @@
 package scraper
 
 import (
+	"Insightify-backend/internal/analyze/devices"
+	"Insightify-backend/internal/analyze/imaging"
+	"Insightify-backend/internal/blobstore"
+	"Insightify-backend/internal/database/models"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"log"
-	"os"
 	"time"
 
-	googleStorage "cloud.google.com/go/storage"
 	"github.com/chromedp/chromedp"
-	"github.com/google/uuid"
-	"github.com/gorilla/websocket"
 )
 
-func (s *Scraper) captureScreenshots(conn *websocket.Conn, ctx context.Context, lastScrollY int) []string {
-	var screenshots []string
+// captureScreenshots scrolls through the page taking a screenshot of every
+// viewport, position is the index the first screenshot is stored at
+func (s *Scraper) captureScreenshots(ctx context.Context, analysis *models.Analysis, profile devices.Profile, lastScrollY int, position int) []capturedScreenshot {
+	var screenshots []capturedScreenshot
 	currentScrollY := 0
-	scrollIncrement := 750
+	// Steps may have left the page scrolled, the capture starts where they left it
+	if len(s.Steps) > 0 {
+		if err := chromedp.Run(ctx, chromedp.Evaluate(`Math.round(window.scrollY)`, &currentScrollY)); err != nil && ctx.Err() == nil {
+			log.Printf("Failed to read the scroll position: %v", err)
+		}
+	}
+	// Consecutive screenshots overlap a little so nothing is cut at the edges
+	scrollIncrement := int(profile.Height) * 7 / 10
 
-	s.sendWebSocketMessage(conn, WebSocketMessage{Type: "status", Content: "Content Capturing has started"})
+	s.sendProgress(WebSocketMessage{Type: "status", Content: "Content Capturing has started"})
 
 	totalHeight := lastScrollY
 	steps := totalHeight / scrollIncrement
@@ -26,13 +37,23 @@ func (s *Scraper) captureScreenshots(conn *websocket.Conn, ctx context.Context,
 		steps++
 	}
 
+	// Fixed and sticky elements are only shown in the first screenshot
+	var hidden []models.HiddenElement
+	defer s.restoreFixedElements(ctx)
+
 	// Scroll, capture screenshot and extract code
 	for i := 0; i < steps; i++ {
 		var screenshot []byte
+		offsetY := currentScrollY
+		hiddenInFrame := s.fixedElementsFor(ctx, i, steps, &hidden)
 		err := s.scrollAndCapture(ctx, &screenshot, &currentScrollY, scrollIncrement)
+		if ctx.Err() != nil {
+			// Cancelled or timed out, the caller decides what to report
+			return screenshots
+		}
 		if err != nil {
 			fmt.Println("Error during scrolling and capture:", err)
-			s.sendWebSocketMessage(conn, WebSocketMessage{Type: "error", Content: "Error during scrolling and capture"})
+			s.sendProgress(WebSocketMessage{Type: "error", Content: "Error during scrolling and capture"})
 			break
 		}
 
@@ -41,21 +62,99 @@ func (s *Scraper) captureScreenshots(conn *websocket.Conn, ctx context.Context,
 			break
 		}
 
-		screenshotURL := s.uploadScreenshot(ctx, string(screenshot), len(screenshots))
-		screenshots = append(screenshots, screenshotURL)
-		fmt.Println("Screenshot captured and uploaded:", screenshotURL)
+		captured, ok := s.storeScreenshot(ctx, analysis, profile, frame{
+			Data:     screenshot,
+			Position: position + len(screenshots),
+			OffsetY:  offsetY,
+			Elements: s.extractSegment(ctx, offsetY, int(profile.Height)),
+			Hidden:   hiddenInFrame,
+		})
+		if !ok {
+			if ctx.Err() != nil {
+				return screenshots
+			}
+			continue
+		}
+		screenshots = append(screenshots, captured)
 		fmt.Println("currentScrollY: ", currentScrollY)
 
 		progress := float64(i+1) / float64(steps) * 100
 		// progressMessage := fmt.Sprintf("Capturing screenshots: %.0f%% completed", progress)
-		s.sendWebSocketMessage(conn, WebSocketMessage{Type: "progress", Content: progress})
+		s.sendProgress(WebSocketMessage{Type: "progress", Content: progress})
 	}
 
-	s.sendWebSocketMessage(conn, WebSocketMessage{Type: "status", Content: "Analysis completed"})
+	s.sendProgress(WebSocketMessage{Type: "status", Content: "Analysis completed"})
 	return screenshots
 }
 
-// NOTE: Extract code from extracted code based on the screenshot
+// frame is a captured screenshot waiting to be encoded and stored
+type frame struct {
+	Data     []byte
+	Position int
+	// OffsetY is the distance of the top of the frame from the top of the page, in CSS pixels
+	OffsetY  int
+	Elements []models.ScreenshotElement
+	Hidden   []models.HiddenElement
+	// Step labels screenshots taken by a screenshot step
+	Step string
+}
+
+// storeScreenshot uploads a screenshot and records it on the analysis together
+// with the elements it shows, failures are reported to the client
+func (s *Scraper) storeScreenshot(ctx context.Context, analysis *models.Analysis, profile devices.Profile, captured frame) (capturedScreenshot, bool) {
+	encoded, err := imaging.Encode(captured.Data, s.Image)
+	if err != nil {
+		log.Printf("Failed to encode screenshot: %v", err)
+		s.sendProgress(WebSocketMessage{Type: "error", Content: "Failed to encode screenshot"})
+		return capturedScreenshot{}, false
+	}
+	if !encoded.WithinBudget {
+		log.Printf("Screenshot is %d bytes at %dpx wide, over the budget of %d bytes", len(encoded.Data), encoded.Width, s.Image.MaxBytes)
+	}
+
+	digest := sha256.Sum256(encoded.Data)
+	objectName := blobstore.ScreenshotPrefix + hex.EncodeToString(digest[:]) + encoded.Format.Extension()
+	elements := scaleElements(captured.Elements, float64(encoded.Width)/float64(profile.Width), encoded.Height)
+
+	screenshot := models.Screenshot{
+		AnalysisID:     analysis.ID,
+		Position:       captured.Position,
+		Device:         profile.Name,
+		OffsetY:        captured.OffsetY,
+		Width:          encoded.Width,
+		Height:         encoded.Height,
+		Format:         string(encoded.Format),
+		Bytes:          len(encoded.Data),
+		ObjectName:     objectName,
+		Elements:       elements,
+		HiddenElements: captured.Hidden,
+		Step:           captured.Step,
+	}
+	// The row is recorded before the object is looked up, so deleting another
+	// screenshot of the same image from now on sees the reference and keeps the object
+	if err := s.Analyses.AddScreenshot(ctx, &screenshot); err != nil {
+		log.Printf("Failed to save screenshot for analysis %d: %v", analysis.ID, err)
+		if ctx.Err() == nil {
+			s.sendProgress(WebSocketMessage{Type: "error", Content: "Failed to save screenshot"})
+		}
+		return capturedScreenshot{}, false
+	}
+
+	screenshotURL := s.uploadScreenshot(ctx, objectName, encoded)
+	if screenshotURL == "" {
+		// Screenshot rows must point at a stored object
+		if err := s.Analyses.DeleteScreenshots(context.Background(), []uint{screenshot.ID}); err != nil {
+			log.Printf("Failed to remove screenshot %d: %v", screenshot.ID, err)
+		}
+		if ctx.Err() == nil {
+			s.sendProgress(WebSocketMessage{Type: "error", Content: "Failed to upload screenshot"})
+		}
+		return capturedScreenshot{}, false
+	}
+	s.objectNames = append(s.objectNames, objectName)
+	log.Printf("Stored screenshot %d as %s", screenshot.ID, objectName)
+	return capturedScreenshot{URL: screenshotURL, Device: profile, Elements: elements, Hidden: captured.Hidden, Step: captured.Step}, true
+}
 
 // ExtractCode extracts the HTML code of the page
 func (s *Scraper) extractCode(ctx context.Context) string {
@@ -89,14 +188,9 @@ func (s *Scraper) extractCode(ctx context.Context) string {
 	return fullHTML
 }
 
-// NOTE: Based on the lenght of the html code and the
-// count of the screenshots I need to implement
-// functionality for dividing the html into segments
-
 // ScrollAndCapture performs incremental scrolls and captures screenshots
 func (s *Scraper) scrollAndCapture(ctx context.Context, screenshot *[]byte, currentScrollY *int, scrollIncrement int) error {
 	return chromedp.Run(ctx,
-		chromedp.EmulateViewport(1920, 1080),
 		chromedp.Sleep(500*time.Millisecond),
 		chromedp.CaptureScreenshot(screenshot),
 		incrementalScroll(ctx, scrollIncrement),
@@ -104,39 +198,29 @@ func (s *Scraper) scrollAndCapture(ctx context.Context, screenshot *[]byte, curr
 	)
 }
 
-// UploadScreenshot uploads the screenshot to Firebase Storage and returns the URL
-func (s *Scraper) uploadScreenshot(ctx context.Context, screenshotData string, index int) string {
-	dateFolder := time.Now().Format("2006-01-02")
-	uuid, err := uuid.NewRandom()
-	if err != nil {
-		log.Printf("Failed to generate UUID: %v", err)
-		return ""
-	}
-	fileName := fmt.Sprintf("%s/screenshot-%d-%s.webp", dateFolder, index, uuid)
-
-	bucket, err := s.FirebaseStorage.Bucket(os.Getenv("FIREBASE_STORAGE_BUCKET"))
+// UploadScreenshot stores the encoded screenshot under objectName, the digest
+// of its bytes, and returns a signed URL. Identical images captured before are
+// shared instead of being uploaded again.
+func (s *Scraper) uploadScreenshot(ctx context.Context, objectName string, screenshot *imaging.Encoded) string {
+	// Checking the store rather than the screenshot rows also restores objects
+	// a concurrent delete removed before this capture's row was recorded
+	exists, err := s.Blobs.Exists(ctx, objectName)
 	if err != nil {
-		log.Printf("Failed to get Firebase Storage bucket: %v", err)
+		log.Printf("Failed to look up screenshot %s: %v", objectName, err)
 		return ""
 	}
-
-	wc := bucket.Object(fileName).NewWriter(ctx)
-	wc.ContentType = "image/webp"
-	if _, err := wc.Write([]byte(screenshotData)); err != nil {
-		log.Printf("Failed to write screenshot to Cloud Storage: %v", err)
-		wc.Close() // Ensure the writer is closed even on failure
-		return ""
-	}
-	if err := wc.Close(); err != nil {
-		log.Printf("Failed to close Cloud Storage writer: %v", err)
+	if exists {
+		log.Printf("Screenshot %s is already stored, skipping the upload", objectName)
+	} else if err := s.Blobs.Put(ctx, objectName, screenshot.Data, screenshot.Format.ContentType()); err != nil {
+		log.Printf("Failed to upload screenshot: %v", err)
 		return ""
 	}
 
-	acl := bucket.Object(fileName).ACL()
-	if err := acl.Set(ctx, googleStorage.AllUsers, googleStorage.RoleReader); err != nil {
-		log.Printf("Failed to set public read ACL on screenshot: %v", err)
+	// The object may be shared, if signing fails it is left to the orphan scan
+	url, err := s.Blobs.SignedURL(ctx, objectName, s.URLExpiry)
+	if err != nil {
+		log.Printf("Failed to sign screenshot URL: %v", err)
 		return ""
 	}
-
-	return "https://storage.googleapis.com/" + os.Getenv("FIREBASE_STORAGE_BUCKET") + "/" + fileName
+	return url
 }
@@ -1,11 +1,13 @@
 package scraper
 
 import (
+	"Insightify-backend/internal/analyze/devices"
 	"context"
 	"fmt"
 	"log"
 	"time"
 
+	"github.com/chromedp/cdproto/emulation"
 	"github.com/chromedp/cdproto/page"
 	"github.com/chromedp/chromedp"
 	"github.com/chromedp/chromedp/kb"
@@ -59,33 +61,76 @@ func incrementalScroll(ctx context.Context, scrollIncrement int) chromedp.Action
 	}
 }
 
-func (s *Scraper) navigateAndSetup(url string) (context.Context, context.CancelFunc, error) {
-	opts := append(chromedp.DefaultExecAllocatorOptions[:],
-		chromedp.UserAgent("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/58.0.3029.110 Safari/537.3"),
-		chromedp.Flag("headless", true),
-		chromedp.Flag("disable-notifications", true),
-		chromedp.Flag("block-new-web-contents", true),
-		chromedp.Flag("disable-popup-blocking", false))
-	allocCtx, _ := chromedp.NewExecAllocator(context.Background(), opts...)
+// emulateDevice applies the viewport, touch support and user agent of the profile to the tab
+func emulateDevice(profile devices.Profile) chromedp.Tasks {
+	return chromedp.Tasks{
+		emulation.SetDeviceMetricsOverride(profile.Width, profile.Height, profile.DeviceScaleFactor, profile.Mobile),
+		emulation.SetTouchEmulationEnabled(profile.Touch),
+		emulation.SetUserAgentOverride(profile.UserAgent),
+	}
+}
+
+// navigateAndSetup opens a tab of a pooled browser for the capture, applies
+// the capture's session and loads the page as the device of profile. The tab
+// is closed when parent is cancelled.
+func (s *Scraper) navigateAndSetup(parent context.Context, url string, profile devices.Profile) (context.Context, context.CancelFunc, error) {
+	lease, err := s.Browsers.Acquire(parent)
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx, innerCancel := context.WithTimeout(lease.Context(), 300*time.Second) // Increased timeout to 300 seconds
 
-	ctx, cancel := chromedp.NewContext(allocCtx)
-	ctx, innerCancel := context.WithTimeout(ctx, 300*time.Second) // Increased timeout to 300 seconds
+	if err := s.applySession(ctx, url); err != nil {
+		innerCancel()
+		lease.Release()
+		return nil, nil, err
+	}
+	if err := s.navigate(ctx, url, profile); err != nil {
+		innerCancel()
+		lease.Release()
+		return nil, nil, err
+	}
+
+	return ctx, func() {
+		innerCancel()
+		lease.Release()
+	}, nil
+}
 
+// navigate loads the page in the tab of ctx as the device of profile
+func (s *Scraper) navigate(ctx context.Context, url string, profile devices.Profile) error {
 	retries := 3
-	for i := 0; i < retries; i++ {
-		if err := chromedp.Run(ctx, enableLifeCycleEvents(), navigateAndWaitFor(url, "networkIdle"), chromedp.Sleep(1000*time.Millisecond), chromedp.KeyEvent(kb.Escape)); err != nil {
-			log.Println("Failed to navigate to:", url, "Attempt:", i+1, "Error:", err)
+	for i := 0; i < retries && ctx.Err() == nil; i++ {
+		tasks := chromedp.Tasks{emulateDevice(profile), enableLifeCycleEvents(), navigateAndWaitFor(url, "networkIdle"), chromedp.Sleep(1000 * time.Millisecond)}
+		if !s.KeepBanners {
+			tasks = append(tasks, chromedp.KeyEvent(kb.Escape))
+		}
+		if err := chromedp.Run(ctx, tasks); err != nil {
+			log.Println("Failed to navigate to:", url, "Device:", profile.Name, "Attempt:", i+1, "Error:", err)
 			time.Sleep(200 * time.Millisecond)
 			continue
 		}
-		log.Println("Navigation completed to:", url)
+		log.Println("Navigation completed to:", url, "Device:", profile.Name)
+		s.dismissOverlays(ctx)
+		return nil
+	}
+	return fmt.Errorf("failed to navigate to %s after %d attempts", url, retries)
+}
 
-		return ctx, func() {
-			innerCancel()
-			cancel()
-		}, nil
+// dismissOverlays closes the consent banners and modals covering the page
+// unless the capture keeps them, reporting what was closed to the job log
+func (s *Scraper) dismissOverlays(ctx context.Context) {
+	if s.KeepBanners || s.Consent == nil {
+		return
+	}
+	result, err := s.Consent.Dismiss(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("Failed to dismiss overlays: %v", err)
+		}
+		return
+	}
+	if result.Dismissed() || result.Skipped {
+		s.sendProgress(WebSocketMessage{Type: "overlays", Content: result})
 	}
-	innerCancel()
-	cancel()
-	return nil, nil, fmt.Errorf("failed to navigate to %s after %d attempts", url, retries)
 }
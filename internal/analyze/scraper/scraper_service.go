@@ -1,55 +1,228 @@
 package scraper
 
 import (
-	"Insightify-backend/internal/utils"
+	"Insightify-backend/internal/analyze/consent"
+	"Insightify-backend/internal/analyze/devices"
+	"Insightify-backend/internal/analyze/flow"
+	"Insightify-backend/internal/analyze/imaging"
+	"Insightify-backend/internal/analyze/llm"
+	"Insightify-backend/internal/analyze/session"
+	"Insightify-backend/internal/blobstore"
+	"Insightify-backend/internal/browser"
+	"Insightify-backend/internal/database/models"
+	"Insightify-backend/internal/progress"
+	"Insightify-backend/internal/services"
 	"context"
 	"fmt"
-
-	"firebase.google.com/go/storage"
-	"github.com/gorilla/websocket"
-	"github.com/redis/go-redis/v9"
+	"log"
+	"time"
 )
 
 type Scraper struct {
-	FirebaseStorage *storage.Client
-	RedisClient     *redis.Client
+	Blobs    blobstore.BlobStore
+	Browsers *browser.Pool
+	LLM      llm.LLMProvider
+	Analyses *services.AnalysisService
+	Progress progress.Publisher
+	JobID    string
+	// Image controls how screenshots are encoded before they are uploaded
+	Image imaging.Options
+	// Consent closes the consent banners and modals covering the page, unless KeepBanners is set
+	Consent     *consent.Dismisser
+	KeepBanners bool
+	// Session is the login state the page is loaded with, nil for anonymous captures
+	Session *session.Session
+	// Steps are run on the page after it is loaded and before it is captured, for every device
+	Steps []flow.Step
+	// Fixed controls hiding fixed and sticky elements after the first frame of a capture
+	Fixed FixedElementOptions
+	// Settle bounds the scrolling that loads lazy content before each capture
+	Settle SettleOptions
+	// URLExpiry is how long the signed screenshot URLs sent to the client and the LLM stay valid
+	URLExpiry time.Duration
+	// objectNames are the objects of this capture's screenshots, removed again when it is cancelled unless shared
+	objectNames []string
 }
 
-type WebSocketMessage struct {
-	Type    string      `json:"type"`
-	Content interface{} `json:"content"`
+// capturedScreenshot is an uploaded screenshot, the device it was taken with, the elements it shows, the fixed ones it
+// leaves out and the scripted step it was taken at
+type capturedScreenshot struct {
+	URL      string
+	Device   devices.Profile
+	Elements []models.ScreenshotElement
+	Hidden   []models.HiddenElement
+	Step     string
 }
 
-func NewScraper(ctx context.Context) *Scraper {
-	storage := utils.NewFirebaseClient(ctx)
+func screenshotURLs(screenshots []capturedScreenshot) []string {
+	urls := make([]string, 0, len(screenshots))
+	for _, screenshot := range screenshots {
+		urls = append(urls, screenshot.URL)
+	}
+	return urls
+}
+
+// WebSocketMessage is a progress update, relayed to the client's WebSocket by the API
+type WebSocketMessage = progress.Message
+
+func NewScraper(blobs blobstore.BlobStore, browsers *browser.Pool, provider llm.LLMProvider, analyses *services.AnalysisService, publisher progress.Publisher, jobID string) *Scraper {
 	return &Scraper{
-		FirebaseStorage: storage,
+		Blobs:     blobs,
+		Browsers:  browsers,
+		LLM:       provider,
+		Analyses:  analyses,
+		Progress:  publisher,
+		JobID:     jobID,
+		Image:     imaging.OptionsFromEnv(),
+		Consent:   consent.NewDismisserFromEnv(),
+		Fixed:     FixedElementOptionsFromEnv(),
+		Settle:    SettleOptionsFromEnv(),
+		URLExpiry: blobstore.URLExpiryFromEnv(),
 	}
 }
 
-func (s *Scraper) CaptureAndUpload(url string, conn *websocket.Conn) []string {
-	s.sendWebSocketMessage(conn, WebSocketMessage{Type: "status", Content: "Your request has been received"})
-	ctx, cancel, err := s.navigateAndSetup(url)
-	if err != nil {
-		s.sendWebSocketMessage(conn, WebSocketMessage{Type: "error", Content: "Failed to setup navigation"})
+// CaptureAndUpload runs the capture pipeline for the analysis, taking the
+// screenshots with each device profile in turn. Cancelling ctx stops the
+// browser and pending uploads, removes what was uploaded so far and marks the
+// analysis as cancelled.
+func (s *Scraper) CaptureAndUpload(ctx context.Context, analysis *models.Analysis, profiles []devices.Profile) []string {
+	if ctx.Err() != nil {
+		s.cancelCapture(analysis)
 		return nil
 	}
-	defer cancel()
 
-	s.sendWebSocketMessage(conn, WebSocketMessage{Type: "status", Content: "Navigation to the provided url completed"})
+	url := analysis.URL
+	s.setStatus(analysis, models.AnalysisStatusCapturing)
 
-	lastScrollY, err := s.determineHeight(ctx)
-	if err != nil {
-		s.sendWebSocketMessage(conn, WebSocketMessage{Type: "error", Content: "Failed to determine page height"})
+	var browserCtx context.Context
+	// releaseBrowser closes the tab and gives the browser back to the pool, calling it again does nothing
+	releaseBrowser := func() {}
+	defer func() { releaseBrowser() }()
+	var screenshots []capturedScreenshot
+	var html string
+	for i, profile := range profiles {
+		s.sendProgress(WebSocketMessage{Type: "device", Content: profile})
+
+		if i == 0 {
+			var err error
+			browserCtx, releaseBrowser, err = s.navigateAndSetup(ctx, url, profile)
+			if err != nil {
+				s.stop(ctx, analysis, "Failed to setup navigation")
+				return nil
+			}
+		} else if err := s.navigate(browserCtx, url, profile); err != nil {
+			s.stop(ctx, analysis, "Failed to navigate as "+profile.Name)
+			return nil
+		}
+
+		s.sendProgress(WebSocketMessage{Type: "status", Content: "Navigation to the provided url completed"})
+
+		lastScrollY, captured, err := s.PreparePage(browserCtx, analysis, profile, len(screenshots))
+		screenshots = append(screenshots, captured...)
+		if err != nil {
+			s.stop(ctx, analysis, err.Error())
+			return nil
+		}
+		fmt.Println("lastScrollY: ", lastScrollY)
+
+		if analysis.Mode == models.CaptureModeFullPage {
+			screenshots = append(screenshots, s.captureFullPage(browserCtx, analysis, profile, len(screenshots))...)
+		} else {
+			screenshots = append(screenshots, s.captureScreenshots(browserCtx, analysis, profile, lastScrollY, len(screenshots))...)
+		}
+		if ctx.Err() != nil {
+			s.cancelCapture(analysis)
+			return nil
+		}
+
+		// The markup sent to the model is the one served to the first device
+		if i == 0 {
+			html = s.extractCode(browserCtx)
+		}
+	}
+	// The analysis does not need the browser, nor should the navigation timeout cut it off
+	releaseBrowser()
+
+	if ctx.Err() != nil || len(screenshots) == 0 {
+		s.stop(ctx, analysis, "No screenshots were captured")
 		return nil
 	}
-	fmt.Println("lastScrollY: ", lastScrollY)
+	urls := screenshotURLs(screenshots)
+	s.sendProgress(WebSocketMessage{Type: "images", Content: urls})
+
+	if err := s.Analyses.SaveHTML(ctx, analysis, html); err != nil {
+		log.Printf("Failed to save extracted HTML for analysis %d: %v", analysis.ID, err)
+	}
+
+	s.setStatus(analysis, models.AnalysisStatusAnalyzing)
+	report, usage, err := s.analyzeCapture(ctx, screenshots, html)
+	if err != nil {
+		if ctx.Err() != nil {
+			s.cancelCapture(analysis)
+			return nil
+		}
+		// analyzeCapture has already reported the error to the client
+		log.Printf("Analysis of job %s failed: %v", s.JobID, err)
+		s.markFailed(analysis, "Failed to generate insights")
+		return urls
+	}
+
+	if err := s.Analyses.CompleteAnalysis(context.Background(), analysis, report, usage); err != nil {
+		log.Printf("Failed to store insights for analysis %d: %v", analysis.ID, err)
+	}
+	return urls
+}
+
+// Finish tells the client that the pipeline has stopped and in which state it left the analysis
+func (s *Scraper) Finish(analysis *models.Analysis) {
+	s.sendProgress(WebSocketMessage{Type: "finished", Content: map[string]interface{}{
+		"analysisId": analysis.ID,
+		"status":     analysis.Status,
+	}})
+}
+
+// setStatus records the pipeline stage, a failed update is logged but does not stop the capture
+func (s *Scraper) setStatus(analysis *models.Analysis, status models.AnalysisStatus) {
+	if err := s.Analyses.UpdateStatus(context.Background(), analysis, status); err != nil {
+		log.Printf("Failed to update analysis %d status: %v", analysis.ID, err)
+	}
+}
+
+// FailAnalysis marks the analysis as failed and reports the reason to the client
+func (s *Scraper) FailAnalysis(analysis *models.Analysis, reason string) {
+	s.sendProgress(WebSocketMessage{Type: "error", Content: reason})
+	s.markFailed(analysis, reason)
+}
+
+// stop ends the pipeline after a failed step, which is a cancellation when ctx has been cancelled
+func (s *Scraper) stop(ctx context.Context, analysis *models.Analysis, reason string) {
+	if ctx.Err() != nil {
+		s.cancelCapture(analysis)
+		return
+	}
+	s.FailAnalysis(analysis, reason)
+}
+
+// cancelCapture removes the screenshots uploaded so far, marks the analysis as
+// cancelled and tells the client
+func (s *Scraper) cancelCapture(analysis *models.Analysis) {
+	if err := s.Analyses.CancelAnalysis(context.Background(), analysis); err != nil {
+		log.Printf("Failed to mark analysis %d as cancelled: %v", analysis.ID, err)
+	}
+	// Objects that other analyses share are kept, anything missed is left to the orphan scan
+	unreferenced, err := s.Analyses.UnreferencedObjects(context.Background(), s.objectNames)
+	if err == nil {
+		err = blobstore.DeleteAll(context.Background(), s.Blobs, unreferenced)
+	}
+	if err != nil {
+		log.Printf("Failed to clean up screenshots of cancelled analysis %d: %v", analysis.ID, err)
+	}
+	s.objectNames = nil
+	s.sendProgress(WebSocketMessage{Type: "cancelled", Content: map[string]interface{}{"analysisId": analysis.ID}})
+}
 
-	screenshots := s.captureScreenshots(conn, ctx, lastScrollY)
-	if len(screenshots) > 0 {
-		s.sendWebSocketMessage(conn, WebSocketMessage{Type: "images", Content: screenshots})
-	} else {
-		s.sendWebSocketMessage(conn, WebSocketMessage{Type: "error", Content: "No screenshots were captured"})
+func (s *Scraper) markFailed(analysis *models.Analysis, reason string) {
+	if err := s.Analyses.FailAnalysis(context.Background(), analysis, reason); err != nil {
+		log.Printf("Failed to mark analysis %d as failed: %v", analysis.ID, err)
 	}
-	return screenshots
 }
@@ -0,0 +1,140 @@
+package scraper
+
+import (
+	"Insightify-backend/internal/database/models"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/chromedp/chromedp"
+)
+
+const (
+	// maxSegmentElements caps how many elements are recorded per screenshot
+	maxSegmentElements = 150
+	// maxElementHTMLLength truncates the markup of a single element
+	maxElementHTMLLength = 2000
+	// maxSegmentHTMLLength caps the markup recorded per screenshot
+	maxSegmentHTMLLength = 30000
+)
+
+// segmentScript collects the elements intersecting the page region from top
+// to bottom, in CSS pixels from the top of the page. Elements that lie within
+// the region are recorded whole, the ones crossing its edges are split into
+// their children. Scripts, styles, event handlers, inline styles and password
+// values are stripped and long attribute values shortened.
+const segmentScript = `(() => {
+	const top = %d, bottom = %d;
+	const maxElements = %d, maxLength = %d, maxTotal = %d;
+	const skipped = new Set(['SCRIPT', 'STYLE', 'NOSCRIPT', 'TEMPLATE', 'LINK', 'META']);
+
+	const sanitize = (el) => {
+		const clone = el.cloneNode(true);
+		clone.querySelectorAll('script, style, noscript, template').forEach(node => node.remove());
+		clone.querySelectorAll('svg').forEach(node => node.replaceChildren());
+		for (const node of [clone, ...clone.querySelectorAll('*')]) {
+			if (node.tagName === 'INPUT' && (node.getAttribute('type') || '').toLowerCase() === 'password') {
+				node.removeAttribute('value');
+			}
+			for (const attr of Array.from(node.attributes)) {
+				if (attr.name.startsWith('on') || attr.name === 'style') {
+					node.removeAttribute(attr.name);
+				} else if (attr.value.length > 200) {
+					node.setAttribute(attr.name, attr.value.slice(0, 200) + '…');
+				}
+			}
+		}
+		const html = clone.outerHTML.replace(/<!--[\s\S]*?-->/g, '').replace(/\s+/g, ' ');
+		return html.length > maxLength ? html.slice(0, maxLength) + '…' : html;
+	};
+
+	const elements = [];
+	let total = 0;
+	const visit = (el) => {
+		if (elements.length >= maxElements || total >= maxTotal || skipped.has(el.tagName)) {
+			return;
+		}
+		const style = window.getComputedStyle(el);
+		if (style.display === 'none' || style.visibility === 'hidden') {
+			return;
+		}
+		const rect = el.getBoundingClientRect();
+		const elTop = rect.top + window.scrollY;
+		const elBottom = rect.bottom + window.scrollY;
+		// Wrappers without a box of their own may still have visible children
+		if (rect.width === 0 || rect.height === 0) {
+			Array.from(el.children).forEach(visit);
+			return;
+		}
+		if (elBottom <= top || elTop >= bottom) {
+			return;
+		}
+		const contained = elTop >= top && elBottom <= bottom;
+		if ((!contained || el.outerHTML.length > maxLength) && el.children.length > 0) {
+			Array.from(el.children).forEach(visit);
+			return;
+		}
+
+		const html = sanitize(el);
+		total += html.length;
+		const x = Math.max(rect.left, 0);
+		const y = Math.max(elTop, top);
+		elements.push({
+			tag: el.tagName.toLowerCase(),
+			x: x,
+			y: y - top,
+			width: Math.min(rect.right, window.innerWidth) - x,
+			height: Math.min(elBottom, bottom) - y,
+			html: html,
+		});
+	};
+	Array.from(document.body.children).forEach(visit);
+	return elements;
+})()`
+
+// extractSegment returns the elements shown in the region of the page that
+// starts offsetY CSS pixels from the top and is height pixels tall, with
+// their boxes relative to the region
+func (s *Scraper) extractSegment(ctx context.Context, offsetY int, height int) []models.ScreenshotElement {
+	var elements []models.ScreenshotElement
+	script := fmt.Sprintf(segmentScript, offsetY, offsetY+height, maxSegmentElements, maxElementHTMLLength, maxSegmentHTMLLength)
+	if err := chromedp.Run(ctx, chromedp.Evaluate(script, &elements)); err != nil {
+		if ctx.Err() == nil {
+			log.Printf("Failed to extract the HTML of the screenshot region: %v", err)
+		}
+		return nil
+	}
+	return elements
+}
+
+// scaleElements converts element boxes from CSS pixels to screenshot pixels,
+// dropping elements outside the viewport or below the bottom of screenshots
+// that were cut off
+func scaleElements(elements []models.ScreenshotElement, scale float64, height int) []models.ScreenshotElement {
+	scaled := elements[:0]
+	for _, element := range elements {
+		element.X *= scale
+		element.Y *= scale
+		element.Width *= scale
+		element.Height = min(element.Height*scale, float64(height)-element.Y)
+		if element.Width > 0 && element.Height > 0 {
+			scaled = append(scaled, element)
+		}
+	}
+	return scaled
+}
+
+// formatElements lists the elements for the prompt, one per line with its box,
+// stopping before maxLength characters
+func formatElements(elements []models.ScreenshotElement, maxLength int) string {
+	var b strings.Builder
+	for _, element := range elements {
+		line := fmt.Sprintf("[x=%.0f y=%.0f w=%.0f h=%.0f] %s\n", element.X, element.Y, element.Width, element.Height, element.HTML)
+		if b.Len()+len(line) > maxLength {
+			break
+		}
+		b.WriteString(line)
+	}
+	return b.String()
+}
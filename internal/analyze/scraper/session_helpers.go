@@ -0,0 +1,173 @@
+package scraper
+
+import (
+	"Insightify-backend/internal/analyze/session"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/fetch"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+)
+
+// seedStorageScript fills localStorage and sessionStorage on every document of
+// the page's origin before its own scripts run
+const seedStorageScript = `(() => {
+	if (location.origin !== %s) {
+		return;
+	}
+	const seed = (storage, items) => {
+		for (const [key, value] of Object.entries(items)) {
+			storage.setItem(key, value);
+		}
+	};
+	try {
+		seed(window.localStorage, %s);
+		seed(window.sessionStorage, %s);
+	} catch (e) {}
+})()`
+
+// applySession sets the cookies of the capture's session in the tab of ctx
+// and arranges for its headers and storage items to be sent and seeded when
+// pageURL is loaded. Values are never logged.
+func (s *Scraper) applySession(ctx context.Context, pageURL string) error {
+	if s.Session == nil || s.Session.Empty() {
+		return nil
+	}
+	parsed, err := url.Parse(pageURL)
+	if err != nil {
+		return err
+	}
+
+	tasks := chromedp.Tasks{network.Enable()}
+	for _, cookie := range s.Session.Cookies {
+		tasks = append(tasks, setCookie(cookie, pageURL))
+	}
+	if len(s.Session.LocalStorage) > 0 || len(s.Session.SessionStorage) > 0 {
+		script, err := storageScript(parsed, s.Session.LocalStorage, s.Session.SessionStorage)
+		if err != nil {
+			return err
+		}
+		tasks = append(tasks, chromedp.ActionFunc(func(ctx context.Context) error {
+			_, err := page.AddScriptToEvaluateOnNewDocument(script).Do(ctx)
+			return err
+		}))
+	}
+	if len(s.Session.Headers) > 0 {
+		s.injectHeaders(ctx, parsed.Hostname(), s.Session.Headers)
+		tasks = append(tasks, fetch.Enable().WithPatterns([]*fetch.RequestPattern{{URLPattern: "*", RequestStage: fetch.RequestStageRequest}}))
+	}
+
+	if err := chromedp.Run(ctx, tasks); err != nil {
+		return fmt.Errorf("failed to apply the capture session: %v", err)
+	}
+	log.Printf("Applied session with %d cookies, %d headers and %d storage items", len(s.Session.Cookies), len(s.Session.Headers), len(s.Session.LocalStorage)+len(s.Session.SessionStorage))
+	return nil
+}
+
+// setCookie sets a cookie of the session, cookies without a domain belong to the page's host only
+func setCookie(cookie session.Cookie, pageURL string) chromedp.Action {
+	params := network.SetCookie(cookie.Name, cookie.Value).WithSecure(cookie.Secure).WithHTTPOnly(cookie.HTTPOnly)
+	if cookie.Domain == "" {
+		params = params.WithURL(pageURL)
+	} else {
+		params = params.WithDomain(cookie.Domain)
+	}
+	path := cookie.Path
+	if path == "" {
+		path = "/"
+	}
+	params = params.WithPath(path)
+	if cookie.SameSite != "" {
+		params = params.WithSameSite(network.CookieSameSite(cookie.SameSite))
+	}
+	if cookie.Expires > 0 {
+		expires := cdp.TimeSinceEpoch(time.Unix(cookie.Expires, 0))
+		params = params.WithExpires(&expires)
+	}
+	return params
+}
+
+// storageScript builds the seed script for the origin of pageURL
+func storageScript(pageURL *url.URL, local map[string]string, sessionItems map[string]string) (string, error) {
+	origin := pageURL.Scheme + "://" + pageURL.Hostname()
+	// location.origin leaves out the default port of the scheme
+	if port := pageURL.Port(); port != "" && !(pageURL.Scheme == "https" && port == "443") && !(pageURL.Scheme == "http" && port == "80") {
+		origin += ":" + port
+	}
+
+	encodedOrigin, err := json.Marshal(strings.ToLower(origin))
+	if err != nil {
+		return "", err
+	}
+	encodedLocal, err := json.Marshal(emptyIfNil(local))
+	if err != nil {
+		return "", err
+	}
+	encodedSession, err := json.Marshal(emptyIfNil(sessionItems))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(seedStorageScript, encodedOrigin, encodedLocal, encodedSession), nil
+}
+
+func emptyIfNil(items map[string]string) map[string]string {
+	if items == nil {
+		return map[string]string{}
+	}
+	return items
+}
+
+// injectHeaders continues the requests paused by the Fetch domain, adding
+// headers to those sent to the page's host and its subdomains so credentials
+// do not reach third parties
+func (s *Scraper) injectHeaders(ctx context.Context, pageHost string, headers map[string]string) {
+	chromedp.ListenTarget(ctx, func(ev interface{}) {
+		paused, ok := ev.(*fetch.EventRequestPaused)
+		if !ok {
+			return
+		}
+		// Commands cannot be sent from the listener itself
+		go func() {
+			continueRequest := fetch.ContinueRequest(paused.RequestID)
+			if requestURL, err := url.Parse(paused.Request.URL); err == nil && session.MatchesHost(pageHost, requestURL.Hostname()) {
+				continueRequest = continueRequest.WithHeaders(mergeHeaders(paused.Request.Headers, headers))
+			}
+			executor := cdp.WithExecutor(ctx, chromedp.FromContext(ctx).Target)
+			if err := continueRequest.Do(executor); err != nil && ctx.Err() == nil {
+				log.Printf("Failed to continue request: %v", err)
+			}
+		}()
+	})
+}
+
+// mergeHeaders returns the request's headers with the session's replacing those of the same name
+func mergeHeaders(request network.Headers, headers map[string]string) []*fetch.HeaderEntry {
+	entries := make([]*fetch.HeaderEntry, 0, len(request)+len(headers))
+	for name, value := range request {
+		if hasHeader(headers, name) {
+			continue
+		}
+		entries = append(entries, &fetch.HeaderEntry{Name: name, Value: fmt.Sprint(value)})
+	}
+	for name, value := range headers {
+		entries = append(entries, &fetch.HeaderEntry{Name: name, Value: value})
+	}
+	return entries
+}
+
+func hasHeader(headers map[string]string, name string) bool {
+	for key := range headers {
+		if strings.EqualFold(key, name) {
+			return true
+		}
+	}
+	return false
+}
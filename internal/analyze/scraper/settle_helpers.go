@@ -0,0 +1,187 @@
+package scraper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/chromedp"
+)
+
+const (
+	defaultSettleMaxHeight    = 30000
+	defaultSettleMaxItems     = 300
+	defaultSettleTimeout      = 30 * time.Second
+	defaultSettleItemSelector = `article, [role="article"], [role="listitem"], li`
+	// settleQuietPeriod is how long no resource may load and no image may be pending for a step to end
+	settleQuietPeriod = 500 * time.Millisecond
+	// settleStepWait caps how long a single step waits for the page to go quiet
+	settleStepWait = 3 * time.Second
+)
+
+// Reasons the settle phase stopped scrolling
+const (
+	SettleStoppedAtBottom    = "bottom"
+	SettleStoppedAtMaxHeight = "max_height"
+	SettleStoppedAtMaxItems  = "max_items"
+	SettleStoppedByTimeout   = "timeout"
+)
+
+// SettleOptions bound the settle phase that scrolls through the page before
+// it is captured, so lazy-loaded content is loaded and infinite feeds end
+type SettleOptions struct {
+	// MaxHeight is the page height in CSS pixels after which scrolling stops and the capture is cut off
+	MaxHeight int
+	// MaxItems stops scrolling once ItemSelector matches as many elements, zero disables the limit
+	MaxItems     int
+	ItemSelector string
+	Timeout      time.Duration
+}
+
+// SettleOptionsFromEnv reads SETTLE_MAX_HEIGHT, SETTLE_MAX_ITEMS,
+// SETTLE_ITEM_SELECTOR and SETTLE_TIMEOUT (a duration such as 45s)
+func SettleOptionsFromEnv() SettleOptions {
+	options := SettleOptions{
+		MaxHeight:    defaultSettleMaxHeight,
+		MaxItems:     defaultSettleMaxItems,
+		ItemSelector: defaultSettleItemSelector,
+		Timeout:      defaultSettleTimeout,
+	}
+	if value, err := strconv.Atoi(os.Getenv("SETTLE_MAX_HEIGHT")); err == nil && value > 0 {
+		options.MaxHeight = value
+	}
+	if value, err := strconv.Atoi(os.Getenv("SETTLE_MAX_ITEMS")); err == nil && value >= 0 {
+		options.MaxItems = value
+	}
+	if selector := os.Getenv("SETTLE_ITEM_SELECTOR"); selector != "" {
+		options.ItemSelector = selector
+	}
+	if value, err := time.ParseDuration(os.Getenv("SETTLE_TIMEOUT")); err == nil && value > 0 {
+		options.Timeout = value
+	}
+	return options
+}
+
+// SettleReport describes what the settle phase did, it is sent to the job log
+type SettleReport struct {
+	Steps         int    `json:"steps"`
+	InitialHeight int    `json:"initialHeight"`
+	FinalHeight   int    `json:"finalHeight"`
+	Growths       int    `json:"growths"`
+	Items         int    `json:"items"`
+	PendingImages int    `json:"pendingImages"`
+	StoppedBy     string `json:"stoppedBy"`
+	DurationMs    int64  `json:"durationMs"`
+}
+
+// settleStep is the state of the page after one step of the settle phase
+type settleStep struct {
+	ScrollY        int  `json:"scrollY"`
+	ViewportHeight int  `json:"viewportHeight"`
+	Height         int  `json:"height"`
+	Grew           bool `json:"grew"`
+	Items          int  `json:"items"`
+	PendingImages  int  `json:"pendingImages"`
+}
+
+// settleStepScript scrolls down most of a viewport, makes lazy images load
+// eagerly and waits until no resource has started loading and no image has
+// been pending for the quiet period, or the step wait has passed
+const settleStepScript = `(async () => {
+	const quietMs = %d, maxWaitMs = %d, selector = %s;
+	performance.setResourceTimingBufferSize(100000);
+	document.querySelectorAll('img[loading="lazy"]').forEach(img => { img.loading = 'eager'; });
+	const before = document.documentElement.scrollHeight;
+	window.scrollBy(0, Math.round(window.innerHeight * 0.9));
+
+	const pendingImages = () => Array.from(document.images).filter(img => !img.complete).length;
+	const started = Date.now();
+	let resources = performance.getEntriesByType('resource').length;
+	let quietSince = Date.now();
+	while (Date.now() - started < maxWaitMs) {
+		await new Promise(resolve => setTimeout(resolve, 100));
+		const current = performance.getEntriesByType('resource').length;
+		if (current !== resources || pendingImages() > 0) {
+			resources = current;
+			quietSince = Date.now();
+			continue;
+		}
+		if (Date.now() - quietSince >= quietMs) {
+			break;
+		}
+	}
+
+	const height = document.documentElement.scrollHeight;
+	let items = 0;
+	try {
+		items = document.querySelectorAll(selector).length;
+	} catch (e) {}
+	return {
+		scrollY: Math.round(window.scrollY),
+		viewportHeight: window.innerHeight,
+		height: height,
+		grew: height > before,
+		items: items,
+		pendingImages: pendingImages(),
+	};
+})()`
+
+// settle scrolls through the page until its height stops growing or a limit
+// of the settle options is reached, and returns the last step
+func (s *Scraper) settle(ctx context.Context) (settleStep, SettleReport, error) {
+	started := time.Now()
+	var report SettleReport
+	if err := chromedp.Run(ctx, chromedp.Evaluate(`document.documentElement.scrollHeight`, &report.InitialHeight)); err != nil {
+		return settleStep{}, report, err
+	}
+
+	selector, err := json.Marshal(s.Settle.ItemSelector)
+	if err != nil {
+		return settleStep{}, report, err
+	}
+	script := fmt.Sprintf(settleStepScript, settleQuietPeriod.Milliseconds(), settleStepWait.Milliseconds(), selector)
+	awaitPromise := func(p *runtime.EvaluateParams) *runtime.EvaluateParams { return p.WithAwaitPromise(true) }
+
+	var step settleStep
+	previousScrollY := -1
+	for {
+		if err := chromedp.Run(ctx, chromedp.Evaluate(script, &step, awaitPromise)); err != nil {
+			return step, report, err
+		}
+		report.Steps++
+		if step.Grew {
+			report.Growths++
+		}
+
+		// A page that no longer scrolls has been read to the end, even when the window is not at the bottom
+		atBottom := step.ScrollY+step.ViewportHeight >= step.Height-1 || step.ScrollY == previousScrollY
+		previousScrollY = step.ScrollY
+
+		switch {
+		case step.Height >= s.Settle.MaxHeight:
+			report.StoppedBy = SettleStoppedAtMaxHeight
+		case s.Settle.MaxItems > 0 && step.Items >= s.Settle.MaxItems:
+			report.StoppedBy = SettleStoppedAtMaxItems
+		case atBottom && !step.Grew:
+			report.StoppedBy = SettleStoppedAtBottom
+		case time.Since(started) >= s.Settle.Timeout:
+			report.StoppedBy = SettleStoppedByTimeout
+		default:
+			continue
+		}
+		break
+	}
+
+	report.FinalHeight = step.Height
+	report.Items = step.Items
+	report.PendingImages = step.PendingImages
+	report.DurationMs = time.Since(started).Milliseconds()
+	log.Printf("Settled page in %d steps: %dpx to %dpx, %d items, %d images pending, stopped by %s",
+		report.Steps, report.InitialHeight, report.FinalHeight, report.Items, report.PendingImages, report.StoppedBy)
+	return step, report, nil
+}
@@ -0,0 +1,223 @@
+package scraper
+
+import (
+	"Insightify-backend/internal/analyze/devices"
+	"Insightify-backend/internal/analyze/flow"
+	"Insightify-backend/internal/database/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/chromedp/cdproto/input"
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/chromedp"
+)
+
+// stepSettleTime lets menus and dialogs opened by a step finish animating
+const stepSettleTime = 300 * time.Millisecond
+
+// selectScript picks the option of a select element by its value or its text
+// and fires the events a user's choice would
+const selectScript = `((selector, value) => {
+	const el = document.querySelector(selector);
+	if (!el) {
+		return 'missing';
+	}
+	if (el.tagName !== 'SELECT') {
+		return 'not_select';
+	}
+	const option = Array.from(el.options).find(option => option.value === value || option.text.trim() === value);
+	if (!option) {
+		return 'no_option';
+	}
+	el.value = option.value;
+	el.dispatchEvent(new Event('input', { bubbles: true }));
+	el.dispatchEvent(new Event('change', { bubbles: true }));
+	return '';
+})(%s, %s)`
+
+// centerScript returns the center of an element in viewport coordinates
+const centerScript = `((selector) => {
+	const rect = document.querySelector(selector).getBoundingClientRect();
+	return { x: rect.left + rect.width / 2, y: rect.top + rect.height / 2 };
+})(%s)`
+
+// networkIdleScript waits until no resource has started loading for the
+// quiet period and reports whether that happened within the wait
+const networkIdleScript = `(async () => {
+	const quietMs = %d, maxWaitMs = %d;
+	performance.setResourceTimingBufferSize(100000);
+	const started = Date.now();
+	let resources = performance.getEntriesByType('resource').length;
+	let quietSince = Date.now();
+	while (Date.now() - started < maxWaitMs) {
+		await new Promise(resolve => setTimeout(resolve, 100));
+		const current = performance.getEntriesByType('resource').length;
+		if (current !== resources) {
+			resources = current;
+			quietSince = Date.now();
+		} else if (Date.now() - quietSince >= quietMs) {
+			return true;
+		}
+	}
+	return false;
+})()`
+
+// runSteps runs the steps of the capture on the page loaded in the tab of ctx
+// and returns the screenshots taken by its screenshot steps, which are stored
+// from position on. The error of a failed step names the step and the device.
+func (s *Scraper) runSteps(ctx context.Context, analysis *models.Analysis, profile devices.Profile, position int) ([]capturedScreenshot, error) {
+	var screenshots []capturedScreenshot
+	for i, step := range s.Steps {
+		s.sendProgress(WebSocketMessage{Type: "step", Content: map[string]interface{}{
+			"index":  i + 1,
+			"step":   step.String(),
+			"device": profile.Name,
+		}})
+
+		var err error
+		if step.Action == flow.ActionScreenshot {
+			var captured capturedScreenshot
+			if captured, err = s.captureStep(ctx, analysis, profile, position+len(screenshots), fmt.Sprintf("step %d: %s", i+1, step)); err == nil {
+				screenshots = append(screenshots, captured)
+			}
+		} else {
+			err = s.runStep(ctx, profile, step)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return screenshots, ctx.Err()
+			}
+			log.Printf("Step %d (%s) failed on %s: %v", i+1, step, profile.Name, err)
+			return screenshots, fmt.Errorf("step %d (%s) failed on %s: %v", i+1, step, profile.Name, err)
+		}
+	}
+	return screenshots, nil
+}
+
+// runStep runs a single step within its timeout, navigate steps load the page
+// like the initial navigation does
+func (s *Scraper) runStep(ctx context.Context, profile devices.Profile, step flow.Step) error {
+	if step.Action == flow.ActionNavigate {
+		return s.navigate(ctx, step.URL, profile)
+	}
+
+	timeout := step.TimeoutDuration()
+	stepCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	selector, err := json.Marshal(step.Selector)
+	if err != nil {
+		return err
+	}
+
+	var tasks chromedp.Tasks
+	switch step.Action {
+	case flow.ActionClick:
+		tasks = chromedp.Tasks{chromedp.Click(step.Selector, chromedp.ByQuery), chromedp.Sleep(stepSettleTime)}
+	case flow.ActionType:
+		tasks = chromedp.Tasks{chromedp.SendKeys(step.Selector, step.Value, chromedp.ByQuery)}
+	case flow.ActionSelect:
+		value, err := json.Marshal(step.Value)
+		if err != nil {
+			return err
+		}
+		var outcome string
+		tasks = chromedp.Tasks{
+			chromedp.WaitVisible(step.Selector, chromedp.ByQuery),
+			chromedp.Evaluate(fmt.Sprintf(selectScript, selector, value), &outcome),
+			chromedp.ActionFunc(func(ctx context.Context) error {
+				switch outcome {
+				case "":
+					return nil
+				case "not_select":
+					return fmt.Errorf("%s is not a select element", step.Selector)
+				case "no_option":
+					return fmt.Errorf("%s has no option with the given value", step.Selector)
+				default:
+					return fmt.Errorf("no element matches %s", step.Selector)
+				}
+			}),
+			chromedp.Sleep(stepSettleTime),
+		}
+	case flow.ActionHover:
+		var center struct {
+			X float64 `json:"x"`
+			Y float64 `json:"y"`
+		}
+		tasks = chromedp.Tasks{
+			chromedp.ScrollIntoView(step.Selector, chromedp.ByQuery),
+			chromedp.Evaluate(fmt.Sprintf(centerScript, selector), &center),
+			chromedp.ActionFunc(func(ctx context.Context) error {
+				return chromedp.MouseEvent(input.MouseMoved, center.X, center.Y).Do(ctx)
+			}),
+			chromedp.Sleep(stepSettleTime),
+		}
+	case flow.ActionWaitForSelector:
+		tasks = chromedp.Tasks{chromedp.WaitVisible(step.Selector, chromedp.ByQuery)}
+	case flow.ActionWaitForNetworkIdle:
+		var idle bool
+		awaitPromise := func(p *runtime.EvaluateParams) *runtime.EvaluateParams { return p.WithAwaitPromise(true) }
+		script := fmt.Sprintf(networkIdleScript, settleQuietPeriod.Milliseconds(), timeout.Milliseconds())
+		if err := chromedp.Run(stepCtx, chromedp.Evaluate(script, &idle, awaitPromise)); err != nil {
+			return stepFailure(stepCtx, ctx, timeout, "the network to go idle", err)
+		}
+		if !idle {
+			return fmt.Errorf("the network was still busy after %v", timeout)
+		}
+		return nil
+	case flow.ActionScroll:
+		if step.Selector != "" {
+			tasks = chromedp.Tasks{chromedp.ScrollIntoView(step.Selector, chromedp.ByQuery)}
+		} else {
+			tasks = chromedp.Tasks{chromedp.Evaluate(fmt.Sprintf("window.scrollTo(0, %d);", step.Y), nil)}
+		}
+		tasks = append(tasks, chromedp.Sleep(stepSettleTime))
+	default:
+		return fmt.Errorf("unknown action %q", step.Action)
+	}
+
+	if err := chromedp.Run(stepCtx, tasks); err != nil {
+		return stepFailure(stepCtx, ctx, timeout, step.Selector, err)
+	}
+	return nil
+}
+
+// stepFailure turns the error of a step into a message for the client,
+// waiting for an element or the network past the timeout is the usual cause
+func stepFailure(stepCtx context.Context, ctx context.Context, timeout time.Duration, waitingFor string, err error) error {
+	if errors.Is(stepCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+		return fmt.Errorf("timed out after %v waiting for %s", timeout, waitingFor)
+	}
+	return err
+}
+
+// captureStep stores a screenshot of the viewport in the state the steps left
+// the page in, labelled with the step
+func (s *Scraper) captureStep(ctx context.Context, analysis *models.Analysis, profile devices.Profile, position int, label string) (capturedScreenshot, error) {
+	var screenshot []byte
+	var scrollY float64
+	err := chromedp.Run(ctx,
+		chromedp.Sleep(500*time.Millisecond),
+		chromedp.Evaluate(`Math.round(window.scrollY)`, &scrollY),
+		chromedp.CaptureScreenshot(&screenshot),
+	)
+	if err != nil {
+		return capturedScreenshot{}, err
+	}
+
+	captured, ok := s.storeScreenshot(ctx, analysis, profile, frame{
+		Data:     screenshot,
+		Position: position,
+		OffsetY:  int(scrollY),
+		Elements: s.extractSegment(ctx, int(scrollY), int(profile.Height)),
+		Step:     label,
+	})
+	if !ok {
+		return capturedScreenshot{}, errors.New("the screenshot could not be stored")
+	}
+	return captured, nil
+}
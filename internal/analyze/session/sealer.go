@@ -0,0 +1,95 @@
+package session
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrNoKey is returned by NewSealerFromEnv when CAPTURE_SECRETS_KEY is not set
+var ErrNoKey = errors.New("CAPTURE_SECRETS_KEY is not set")
+
+// Sealer encrypts sessions with AES-256-GCM, so they are not readable in the
+// job queue. The API and the workers share its key.
+type Sealer struct {
+	aead cipher.AEAD
+}
+
+// NewSealer creates a sealer for a key of 32 bytes
+func NewSealer(key []byte) (*Sealer, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("session key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Sealer{aead: aead}, nil
+}
+
+// NewSealerFromEnv reads the base64 encoded key in CAPTURE_SECRETS_KEY
+func NewSealerFromEnv() (*Sealer, error) {
+	value := os.Getenv("CAPTURE_SECRETS_KEY")
+	if value == "" {
+		return nil, ErrNoKey
+	}
+	key, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("CAPTURE_SECRETS_KEY is not valid base64: %v", err)
+	}
+	return NewSealer(key)
+}
+
+// NewEphemeralSealer uses a random key, sessions it seals can only be opened
+// by the same process
+func NewEphemeralSealer() *Sealer {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(fmt.Sprintf("failed to generate session key: %v", err))
+	}
+	sealer, _ := NewSealer(key)
+	return sealer
+}
+
+// Seal encrypts the session and returns it base64 encoded
+func (s *Sealer) Seal(session Session) (string, error) {
+	plaintext, err := json.Marshal(session)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(s.aead.Seal(nonce, nonce, plaintext, nil)), nil
+}
+
+// Open decrypts a session sealed with the same key
+func (s *Sealer) Open(sealed string) (Session, error) {
+	var session Session
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return session, fmt.Errorf("invalid sealed session: %v", err)
+	}
+	if len(data) < s.aead.NonceSize() {
+		return session, errors.New("invalid sealed session: too short")
+	}
+	nonce, ciphertext := data[:s.aead.NonceSize()], data[s.aead.NonceSize():]
+	plaintext, err := s.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return session, fmt.Errorf("failed to decrypt session: %v", err)
+	}
+	if err := json.Unmarshal(plaintext, &session); err != nil {
+		return session, fmt.Errorf("invalid sealed session: %v", err)
+	}
+	return session, nil
+}
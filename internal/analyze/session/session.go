@@ -0,0 +1,122 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const (
+	// maxSize caps the encoded session, which travels with the queued job
+	maxSize  = 64 << 10
+	maxItems = 100
+)
+
+// forbiddenHeaders are set by the browser itself, cookies are passed as cookies
+var forbiddenHeaders = map[string]bool{
+	"host":              true,
+	"content-length":    true,
+	"connection":        true,
+	"transfer-encoding": true,
+	"cookie":            true,
+}
+
+// Session is the login state a capture starts with, for pages behind a login.
+// It is sealed before it is queued and never sent back to the client.
+type Session struct {
+	Cookies []Cookie `json:"cookies,omitempty"`
+	// Headers are sent with the requests to the page's host and its subdomains only
+	Headers map[string]string `json:"headers,omitempty"`
+	// LocalStorage and SessionStorage are seeded on the page's origin before its scripts run
+	LocalStorage   map[string]string `json:"localStorage,omitempty"`
+	SessionStorage map[string]string `json:"sessionStorage,omitempty"`
+}
+
+// Cookie is set in the browser before the page is loaded, without a domain it
+// is a host-only cookie of the page
+type Cookie struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Domain   string `json:"domain,omitempty"`
+	Path     string `json:"path,omitempty"`
+	Secure   bool   `json:"secure,omitempty"`
+	HTTPOnly bool   `json:"httpOnly,omitempty"`
+	// SameSite is Strict, Lax or None
+	SameSite string `json:"sameSite,omitempty"`
+	// Expires is in seconds since the epoch, zero for a session cookie
+	Expires int64 `json:"expires,omitempty"`
+}
+
+func (s Session) Empty() bool {
+	return len(s.Cookies) == 0 && len(s.Headers) == 0 && len(s.LocalStorage) == 0 && len(s.SessionStorage) == 0
+}
+
+// Validate checks the session can be used for capturing pageURL. Cookies may
+// only be set for the page's host or a domain it belongs to.
+func (s Session) Validate(pageURL string) error {
+	parsed, err := url.Parse(pageURL)
+	if err != nil || parsed.Hostname() == "" {
+		return fmt.Errorf("invalid URL for an authenticated capture")
+	}
+	host := strings.ToLower(parsed.Hostname())
+
+	if len(s.Cookies) > maxItems || len(s.Headers) > maxItems || len(s.LocalStorage) > maxItems || len(s.SessionStorage) > maxItems {
+		return fmt.Errorf("a session can hold at most %d cookies, headers and storage items of each kind", maxItems)
+	}
+	encoded, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if len(encoded) > maxSize {
+		return fmt.Errorf("the session is larger than %d bytes", maxSize)
+	}
+
+	for i, cookie := range s.Cookies {
+		if !validToken(cookie.Name) {
+			return fmt.Errorf("cookie %d has an invalid name", i)
+		}
+		if strings.ContainsAny(cookie.Value, ";\r\n") {
+			return fmt.Errorf("cookie %q has an invalid value", cookie.Name)
+		}
+		if domain := strings.ToLower(strings.TrimPrefix(cookie.Domain, ".")); domain != "" && host != domain && !strings.HasSuffix(host, "."+domain) {
+			return fmt.Errorf("cookie %q is for %s, not for the captured page", cookie.Name, cookie.Domain)
+		}
+		switch cookie.SameSite {
+		case "", "Strict", "Lax", "None":
+		default:
+			return fmt.Errorf("cookie %q has an invalid sameSite, use Strict, Lax or None", cookie.Name)
+		}
+	}
+	for name, value := range s.Headers {
+		if !validToken(name) {
+			return fmt.Errorf("invalid header name %q", name)
+		}
+		if forbiddenHeaders[strings.ToLower(name)] {
+			return fmt.Errorf("header %s is set by the browser, pass cookies in the session's cookies", name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("header %s has an invalid value", name)
+		}
+	}
+	return nil
+}
+
+// validToken reports whether name is a valid HTTP header or cookie name
+func validToken(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if r <= ' ' || r >= 0x7f || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchesHost reports whether requests to host get the session's headers
+func MatchesHost(pageHost, host string) bool {
+	pageHost, host = strings.ToLower(pageHost), strings.ToLower(host)
+	return host == pageHost || strings.HasSuffix(host, "."+pageHost)
+}
@@ -0,0 +1,95 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	defaultURLExpiry = time.Hour
+	// maxURLExpiry is the longest S3 and Cloud Storage V4 signatures are valid for
+	maxURLExpiry = 7 * 24 * time.Hour
+)
+
+// ScreenshotPrefix is the key prefix screenshots are stored under, the
+// retention sweeper leaves keys outside of it alone
+const ScreenshotPrefix = "screenshots/"
+
+// ErrNotFound is returned by Get for keys that do not exist
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore stores uploaded files such as screenshots under a key. Blobs are
+// private, clients download them through signed URLs that expire.
+type BlobStore interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Exists reports whether a blob is stored under the key without downloading it
+	Exists(ctx context.Context, key string) (bool, error)
+	// Delete removes the blob, deleting a key that does not exist is not an error
+	Delete(ctx context.Context, key string) error
+	// SignedURL returns an address clients can download the blob from until expiry has passed
+	SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error)
+	// List calls fn for every stored blob whose key starts with prefix, stopping at the first error fn returns
+	List(ctx context.Context, prefix string, fn func(Object) error) error
+}
+
+// PublicAccessRemover is implemented by stores that kept per object access
+// rules, objects stored before blobs were private can be read by anyone
+type PublicAccessRemover interface {
+	// MakePrivate removes public read access from the blob, blobs that are not public are left as they are
+	MakePrivate(ctx context.Context, key string) error
+}
+
+// Object describes a stored blob
+type Object struct {
+	Key      string
+	Size     int64
+	Modified time.Time
+}
+
+// New creates the store selected by BLOB_STORE: firebase (Google Cloud
+// Storage), s3 (any S3 compatible service such as MinIO) or local. Without
+// BLOB_STORE Firebase is used when its credentials are set, the local disk otherwise.
+func New(ctx context.Context) (BlobStore, error) {
+	backend := os.Getenv("BLOB_STORE")
+	if backend == "" {
+		backend = "local"
+		if os.Getenv("FIREBASE_CREDENTIALS_BASE64") != "" {
+			backend = "firebase"
+		}
+	}
+
+	switch backend {
+	case "firebase", "gcs":
+		return NewGCSStoreFromEnv(ctx)
+	case "s3", "minio":
+		return NewS3StoreFromEnv()
+	case "local":
+		return NewLocalStoreFromEnv()
+	default:
+		return nil, fmt.Errorf("unknown BLOB_STORE %q", backend)
+	}
+}
+
+// URLExpiryFromEnv reads how long signed URLs stay valid from BLOB_URL_EXPIRY
+// (a duration such as 30m), one hour by default and at most seven days
+func URLExpiryFromEnv() time.Duration {
+	expiry, err := time.ParseDuration(os.Getenv("BLOB_URL_EXPIRY"))
+	if err != nil || expiry <= 0 {
+		return defaultURLExpiry
+	}
+	return min(expiry, maxURLExpiry)
+}
+
+// DeleteAll removes the given blobs, stopping at the first failure
+func DeleteAll(ctx context.Context, store BlobStore, keys []string) error {
+	for _, key := range keys {
+		if err := store.Delete(ctx, key); err != nil {
+			return fmt.Errorf("failed to delete %s: %v", key, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package blobstore
+
+import (
+	"Insightify-backend/internal/utils"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	googleStorage "cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+)
+
+// GCSStore keeps blobs in a Google Cloud Storage bucket, such as the one of a Firebase project
+type GCSStore struct {
+	bucket *googleStorage.BucketHandle
+}
+
+// NewGCSStoreFromEnv uses the Firebase credentials and FIREBASE_STORAGE_BUCKET
+func NewGCSStoreFromEnv(ctx context.Context) (*GCSStore, error) {
+	client, err := utils.NewFirebaseClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	bucketName := os.Getenv("FIREBASE_STORAGE_BUCKET")
+	bucket, err := client.Bucket(bucketName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Firebase Storage bucket: %v", err)
+	}
+	return &GCSStore{bucket: bucket}, nil
+}
+
+func (s *GCSStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	wc := s.bucket.Object(key).NewWriter(ctx)
+	wc.ContentType = contentType
+	if _, err := wc.Write(data); err != nil {
+		wc.Close() // Ensure the writer is closed even on failure
+		return fmt.Errorf("failed to write to Cloud Storage: %v", err)
+	}
+	if err := wc.Close(); err != nil {
+		return fmt.Errorf("failed to close Cloud Storage writer: %v", err)
+	}
+	return nil
+}
+
+func (s *GCSStore) Get(ctx context.Context, key string) ([]byte, error) {
+	reader, err := s.bucket.Object(key).NewReader(ctx)
+	if errors.Is(err, googleStorage.ErrObjectNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+func (s *GCSStore) Exists(ctx context.Context, key string) (bool, error) {
+	_, err := s.bucket.Object(key).Attrs(ctx)
+	if errors.Is(err, googleStorage.ErrObjectNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *GCSStore) Delete(ctx context.Context, key string) error {
+	err := s.bucket.Object(key).Delete(ctx)
+	if err != nil && !errors.Is(err, googleStorage.ErrObjectNotExist) {
+		return err
+	}
+	return nil
+}
+
+// SignedURL signs with the service account of the Firebase credentials
+func (s *GCSStore) SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	return s.bucket.SignedURL(key, &googleStorage.SignedURLOptions{
+		Scheme:  googleStorage.SigningSchemeV4,
+		Method:  "GET",
+		Expires: time.Now().Add(expiry),
+	})
+}
+
+// MakePrivate removes the allUsers reader entry objects were uploaded with
+// before screenshots were private
+func (s *GCSStore) MakePrivate(ctx context.Context, key string) error {
+	err := s.bucket.Object(key).ACL().Delete(ctx, googleStorage.AllUsers)
+	var apiErr *googleapi.Error
+	if errors.Is(err, googleStorage.ErrObjectNotExist) || (errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (s *GCSStore) List(ctx context.Context, prefix string, fn func(Object) error) error {
+	objects := s.bucket.Objects(ctx, &googleStorage.Query{Prefix: prefix})
+	for {
+		attrs, err := objects.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(Object{Key: attrs.Name, Size: attrs.Size, Modified: attrs.Updated}); err != nil {
+			return err
+		}
+	}
+}
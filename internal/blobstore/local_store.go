@@ -0,0 +1,180 @@
+package blobstore
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultLocalDir = "data/blobs"
+
+// LocalStore keeps blobs on the local disk, for development and tests. The
+// API serves them under its base URL through Handler, URLs are signed with an
+// HMAC of the key and expiry time.
+type LocalStore struct {
+	dir     string
+	baseURL string
+	secret  []byte
+}
+
+// NewLocalStoreFromEnv stores blobs in LOCAL_STORAGE_DIR, served from
+// LOCAL_STORAGE_URL (http://localhost:$PORT/blobs by default) and signed with
+// LOCAL_STORAGE_SECRET. The API and workers must share the secret, without it
+// a random one is used and URLs only work in the process that signed them.
+func NewLocalStoreFromEnv() (*LocalStore, error) {
+	dir := os.Getenv("LOCAL_STORAGE_DIR")
+	if dir == "" {
+		dir = defaultLocalDir
+	}
+	baseURL := os.Getenv("LOCAL_STORAGE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:" + os.Getenv("PORT") + "/blobs"
+	}
+
+	secret := []byte(os.Getenv("LOCAL_STORAGE_SECRET"))
+	if len(secret) == 0 {
+		log.Println("LOCAL_STORAGE_SECRET is not set, signing blob URLs with a random secret")
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, fmt.Errorf("error generating storage secret: %v", err)
+		}
+	}
+	return NewLocalStore(dir, baseURL, secret)
+}
+
+func NewLocalStore(dir string, baseURL string, secret []byte) (*LocalStore, error) {
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("a secret is required to sign blob URLs")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating storage directory: %v", err)
+	}
+	return &LocalStore{dir: dir, baseURL: strings.TrimSuffix(baseURL, "/"), secret: secret}, nil
+}
+
+// path maps the key to a file inside the storage directory, rejecting keys that would escape it
+func (s *LocalStore) path(key string) (string, error) {
+	if !fs.ValidPath(key) {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(key)), nil
+}
+
+func (s *LocalStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+func (s *LocalStore) Get(ctx context.Context, key string) ([]byte, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+func (s *LocalStore) Exists(ctx context.Context, key string) (bool, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return false, err
+	}
+	_, err = os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *LocalStore) List(ctx context.Context, prefix string, fn func(Object) error) error {
+	// Only the directory the prefix points into is walked
+	root := s.dir
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		root = filepath.Join(s.dir, filepath.FromSlash(prefix[:i]))
+	}
+	if _, err := os.Stat(root); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		key, err := filepath.Rel(s.dir, path)
+		if err != nil {
+			return err
+		}
+		if key = filepath.ToSlash(key); !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		return fn(Object{Key: key, Size: info.Size(), Modified: info.ModTime()})
+	})
+}
+
+func (s *LocalStore) SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	if !fs.ValidPath(key) {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+	expires := strconv.FormatInt(time.Now().Add(expiry).Unix(), 10)
+	query := url.Values{"expires": {expires}, "signature": {s.sign(key, expires)}}
+	return s.baseURL + "/" + (&url.URL{Path: key}).EscapedPath() + "?" + query.Encode(), nil
+}
+
+func (s *LocalStore) sign(key string, expires string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(key + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Handler serves the stored blobs to requests with a valid, unexpired
+// signature. Mount it with the path prefix stripped.
+func (s *LocalStore) Handler() http.Handler {
+	files := http.FileServer(http.Dir(s.dir))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.URL.Path, "/")
+		expires := r.URL.Query().Get("expires")
+		unix, err := strconv.ParseInt(expires, 10, 64)
+		if err != nil || time.Now().Unix() > unix ||
+			!hmac.Equal([]byte(s.sign(key, expires)), []byte(r.URL.Query().Get("signature"))) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		files.ServeHTTP(w, r)
+	})
+}
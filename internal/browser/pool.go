@@ -0,0 +1,411 @@
+package browser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+const (
+	defaultMaxJobs = 50
+	// healthCheckTimeout is how long a browser may take to answer before it is considered crashed
+	healthCheckTimeout = 5 * time.Second
+	// connectTimeout is how long connecting to a remote browser may take
+	connectTimeout = 10 * time.Second
+	// endpointRetryDelay is how long a remote endpoint that failed is skipped
+	endpointRetryDelay = 30 * time.Second
+)
+
+// Config sizes the pool
+type Config struct {
+	// Size is the number of Chrome instances kept running
+	Size int
+	// MaxJobs is how many jobs a browser serves before it is restarted
+	MaxJobs int
+	// RemoteURLs are DevTools endpoints of already running browsers, such as
+	// ws://chrome:9222. When empty a local Chrome binary is started instead.
+	RemoteURLs []string
+}
+
+// ConfigFromEnv reads BROWSER_POOL_SIZE, BROWSER_MAX_JOBS and the comma
+// separated CHROME_REMOTE_URLS, the pool size defaults to defaultSize
+func ConfigFromEnv(defaultSize int) Config {
+	var remoteURLs []string
+	for _, url := range strings.Split(os.Getenv("CHROME_REMOTE_URLS"), ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			remoteURLs = append(remoteURLs, url)
+		}
+	}
+
+	return Config{
+		Size:       envInt("BROWSER_POOL_SIZE", defaultSize),
+		MaxJobs:    envInt("BROWSER_MAX_JOBS", defaultMaxJobs),
+		RemoteURLs: remoteURLs,
+	}
+}
+
+func envInt(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < 1 {
+		log.Printf("Ignoring invalid %s: %s", key, value)
+		return fallback
+	}
+	return parsed
+}
+
+// Stats describes the state of the pool
+type Stats struct {
+	Size     int   `json:"size"`
+	Running  int   `json:"running"`
+	InUse    int   `json:"inUse"`
+	Started  int64 `json:"started"`
+	Recycled int64 `json:"recycled"`
+	Crashed  int64 `json:"crashed"`
+	Jobs     int64 `json:"jobs"`
+	// Endpoints lists the remote browsers, it is empty when Chrome runs locally
+	Endpoints []EndpointStats `json:"endpoints,omitempty"`
+}
+
+type EndpointStats struct {
+	URL      string `json:"url"`
+	Healthy  bool   `json:"healthy"`
+	Browsers int    `json:"browsers"`
+}
+
+// endpoint is a remote browser the pool connects to
+type endpoint struct {
+	url       string
+	downUntil time.Time
+	browsers  int
+}
+
+// instance is a running Chrome process, or a connection to a remote one
+type instance struct {
+	ctx         context.Context
+	cancel      context.CancelFunc
+	allocCancel context.CancelFunc
+	// endpoint is nil for local browsers
+	endpoint *endpoint
+	jobs     int
+}
+
+func (i *instance) close() {
+	i.cancel()
+	i.allocCancel()
+}
+
+// healthy reports whether the browser still answers
+func (i *instance) healthy() bool {
+	ctx, cancel := context.WithTimeout(i.ctx, healthCheckTimeout)
+	defer cancel()
+	var result int
+	return chromedp.Run(ctx, chromedp.Evaluate(`1`, &result)) == nil
+}
+
+// Pool keeps Chrome instances warm and lends them to one job at a time, each
+// job getting its own browser context so no cookies or storage leak between
+// jobs. With remote endpoints configured it holds connections to them instead
+// and fails over to the next endpoint when one stops answering.
+type Pool struct {
+	config Config
+	// slots holds an entry per pool slot that is not in use, nil when its browser is not running
+	slots     chan *instance
+	lock      sync.Mutex
+	stats     Stats
+	closed    bool
+	endpoints []*endpoint
+	// next is the endpoint the next browser connects to first, so browsers spread over them
+	next int
+}
+
+// NewPool creates the pool and starts its browsers in the background
+func NewPool(config Config) *Pool {
+	if config.Size < 1 {
+		config.Size = 1
+	}
+	if config.MaxJobs < 1 {
+		config.MaxJobs = defaultMaxJobs
+	}
+
+	p := &Pool{
+		config: config,
+		slots:  make(chan *instance, config.Size),
+		stats:  Stats{Size: config.Size},
+	}
+	for _, url := range config.RemoteURLs {
+		p.endpoints = append(p.endpoints, &endpoint{url: url})
+	}
+	for i := 0; i < config.Size; i++ {
+		go p.warm()
+	}
+	return p
+}
+
+// warm starts the browser of a slot, a failed start is retried when the slot is acquired
+func (p *Pool) warm() {
+	inst, err := p.start()
+	if err != nil {
+		log.Printf("Failed to start browser: %v", err)
+	}
+
+	p.lock.Lock()
+	closed := p.closed
+	p.lock.Unlock()
+	if closed && inst != nil {
+		p.discard(inst, false)
+		return
+	}
+	p.slots <- inst
+}
+
+// start launches a local browser, or connects to the first remote endpoint
+// that answers, preferring the ones that have not failed recently
+func (p *Pool) start() (*instance, error) {
+	if len(p.endpoints) == 0 {
+		return p.launch(nil)
+	}
+
+	var errs []error
+	for _, endpoint := range p.endpointOrder() {
+		inst, err := p.launch(endpoint)
+		if err == nil {
+			return inst, nil
+		}
+		log.Printf("Failed to connect to browser at %s: %v", endpoint.url, err)
+		p.markDown(endpoint)
+		errs = append(errs, err)
+	}
+	return nil, fmt.Errorf("no remote browser available: %v", errors.Join(errs...))
+}
+
+// endpointOrder returns the endpoints to try, healthy ones first and starting
+// after the one used last
+func (p *Pool) endpointOrder() []*endpoint {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	now := time.Now()
+	var healthy, down []*endpoint
+	for i := range p.endpoints {
+		endpoint := p.endpoints[(p.next+i)%len(p.endpoints)]
+		if endpoint.downUntil.After(now) {
+			down = append(down, endpoint)
+		} else {
+			healthy = append(healthy, endpoint)
+		}
+	}
+	p.next = (p.next + 1) % len(p.endpoints)
+	return append(healthy, down...)
+}
+
+func (p *Pool) markDown(endpoint *endpoint) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	endpoint.downUntil = time.Now().Add(endpointRetryDelay)
+}
+
+func (p *Pool) launch(endpoint *endpoint) (*instance, error) {
+	var allocCtx context.Context
+	var allocCancel context.CancelFunc
+	timeout := time.Duration(0)
+	if endpoint == nil {
+		opts := append(chromedp.DefaultExecAllocatorOptions[:],
+			chromedp.UserAgent("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/58.0.3029.110 Safari/537.3"),
+			chromedp.Flag("headless", true),
+			chromedp.Flag("disable-notifications", true),
+			chromedp.Flag("block-new-web-contents", true),
+			chromedp.Flag("disable-popup-blocking", false))
+		allocCtx, allocCancel = chromedp.NewExecAllocator(context.Background(), opts...)
+	} else {
+		allocCtx, allocCancel = chromedp.NewRemoteAllocator(context.Background(), endpoint.url)
+		timeout = connectTimeout
+	}
+	ctx, cancel := chromedp.NewContext(allocCtx)
+
+	// Running without actions launches the browser, or connects to it
+	if err := runWithTimeout(ctx, timeout); err != nil {
+		cancel()
+		allocCancel()
+		return nil, err
+	}
+
+	p.lock.Lock()
+	p.stats.Started++
+	p.stats.Running++
+	if endpoint != nil {
+		endpoint.browsers++
+		endpoint.downUntil = time.Time{}
+	}
+	p.lock.Unlock()
+	return &instance{ctx: ctx, cancel: cancel, allocCancel: allocCancel, endpoint: endpoint}, nil
+}
+
+// runWithTimeout runs ctx, giving up after timeout when it is not zero. The
+// timeout is not set on ctx itself, which would also end the browser session.
+func runWithTimeout(ctx context.Context, timeout time.Duration) error {
+	if timeout == 0 {
+		return chromedp.Run(ctx)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- chromedp.Run(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(timeout):
+		return fmt.Errorf("timed out after %s", timeout)
+	}
+}
+
+// discard shuts the browser down
+func (p *Pool) discard(inst *instance, crashed bool) {
+	inst.close()
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.stats.Running--
+	if crashed {
+		p.stats.Crashed++
+	} else {
+		p.stats.Recycled++
+	}
+	if inst.endpoint != nil {
+		inst.endpoint.browsers--
+		if crashed {
+			// Fail over to the other endpoints for a while
+			inst.endpoint.downUntil = time.Now().Add(endpointRetryDelay)
+		}
+	}
+}
+
+// Lease is a browser context handed to a job
+type Lease struct {
+	ctx     context.Context
+	release func()
+}
+
+// Context is the chromedp context of the job's tab, it is cancelled together with the job
+func (l *Lease) Context() context.Context {
+	return l.ctx
+}
+
+// Release closes the tab and its browser context and returns the browser to the pool
+func (l *Lease) Release() {
+	l.release()
+}
+
+// Acquire waits for a free browser and opens a tab in a fresh browser context
+// for the job. The tab is closed when ctx is cancelled.
+func (p *Pool) Acquire(ctx context.Context) (*Lease, error) {
+	var inst *instance
+	select {
+	case inst = <-p.slots:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	if inst != nil && !inst.healthy() {
+		log.Println("Browser stopped responding, restarting it")
+		p.discard(inst, true)
+		inst = nil
+	}
+	if inst == nil {
+		var err error
+		if inst, err = p.start(); err != nil {
+			p.slots <- nil
+			return nil, fmt.Errorf("failed to start browser: %v", err)
+		}
+	}
+
+	tabCtx, tabCancel := chromedp.NewContext(inst.ctx, chromedp.WithNewBrowserContext())
+	stop := context.AfterFunc(ctx, tabCancel)
+
+	p.lock.Lock()
+	p.stats.InUse++
+	p.lock.Unlock()
+
+	var once sync.Once
+	return &Lease{ctx: tabCtx, release: func() {
+		once.Do(func() {
+			stop()
+			tabCancel()
+			p.giveBack(inst)
+		})
+	}}, nil
+}
+
+// giveBack returns a browser after a job, restarting it once it has served
+// MaxJobs jobs or when it no longer responds
+func (p *Pool) giveBack(inst *instance) {
+	inst.jobs++
+
+	p.lock.Lock()
+	p.stats.InUse--
+	p.stats.Jobs++
+	closed := p.closed
+	p.lock.Unlock()
+
+	switch {
+	case closed:
+		p.discard(inst, false)
+		return
+	case inst.jobs >= p.config.MaxJobs:
+		p.discard(inst, false)
+		go p.warm()
+		return
+	case !inst.healthy():
+		p.discard(inst, true)
+		go p.warm()
+		return
+	}
+	p.slots <- inst
+}
+
+// Stats returns a snapshot of the pool counters
+func (p *Pool) Stats() Stats {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	stats := p.stats
+	now := time.Now()
+	for _, endpoint := range p.endpoints {
+		stats.Endpoints = append(stats.Endpoints, EndpointStats{
+			URL:      endpoint.url,
+			Healthy:  !endpoint.downUntil.After(now),
+			Browsers: endpoint.browsers,
+		})
+	}
+	return stats
+}
+
+// Close shuts down the idle browsers, the ones in use are shut down when released
+func (p *Pool) Close() {
+	p.lock.Lock()
+	p.closed = true
+	p.lock.Unlock()
+
+	for {
+		select {
+		case inst := <-p.slots:
+			if inst != nil {
+				p.discard(inst, false)
+			}
+		default:
+			return
+		}
+	}
+}
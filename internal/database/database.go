@@ -1,6 +1,7 @@
 package database
 
 import (
+	"Insightify-backend/internal/database/models"
 	"fmt"
 	"log"
 	"os"
@@ -26,6 +27,11 @@ func New() Service {
 		log.Fatalf("failed to connect database: %v", err)
 	}
 
+	err = db.AutoMigrate(&models.User{}, &models.Analysis{}, &models.Screenshot{}, &models.Insight{})
+	if err != nil {
+		log.Fatalf("failed to migrate database: %v", err)
+	}
+
 	return &service{db: db}
 }
 
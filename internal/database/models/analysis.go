@@ -0,0 +1,158 @@
+package models
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+type AnalysisStatus string
+
+const (
+	AnalysisStatusQueued    AnalysisStatus = "queued"
+	AnalysisStatusCapturing AnalysisStatus = "capturing"
+	AnalysisStatusAnalyzing AnalysisStatus = "analyzing"
+	AnalysisStatusDone      AnalysisStatus = "done"
+	AnalysisStatusFailed    AnalysisStatus = "failed"
+	AnalysisStatusCancelled AnalysisStatus = "cancelled"
+)
+
+// analysisTransitions lists the statuses each status may move to
+var analysisTransitions = map[AnalysisStatus][]AnalysisStatus{
+	AnalysisStatusQueued:    {AnalysisStatusCapturing, AnalysisStatusFailed, AnalysisStatusCancelled},
+	AnalysisStatusCapturing: {AnalysisStatusAnalyzing, AnalysisStatusFailed, AnalysisStatusCancelled},
+	AnalysisStatusAnalyzing: {AnalysisStatusDone, AnalysisStatusFailed, AnalysisStatusCancelled},
+}
+
+// CanTransitionTo reports whether an analysis may move from s to next
+func (s AnalysisStatus) CanTransitionTo(next AnalysisStatus) bool {
+	for _, allowed := range analysisTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// Valid reports whether s is a known analysis status
+func (s AnalysisStatus) Valid() bool {
+	switch s {
+	case AnalysisStatusQueued, AnalysisStatusCapturing, AnalysisStatusAnalyzing, AnalysisStatusDone, AnalysisStatusFailed, AnalysisStatusCancelled:
+		return true
+	}
+	return false
+}
+
+// IsFinished reports whether the pipeline has stopped for good
+func (s AnalysisStatus) IsFinished() bool {
+	return s == AnalysisStatusDone || s == AnalysisStatusFailed || s == AnalysisStatusCancelled
+}
+
+// CaptureMode is how a page is turned into screenshots
+type CaptureMode string
+
+const (
+	// CaptureModeSegmented takes a screenshot per viewport while scrolling down the page
+	CaptureModeSegmented CaptureMode = "segmented"
+	// CaptureModeFullPage takes a single screenshot of the whole page
+	CaptureModeFullPage CaptureMode = "fullpage"
+)
+
+// Valid reports whether m is a known capture mode
+func (m CaptureMode) Valid() bool {
+	return m == CaptureModeSegmented || m == CaptureModeFullPage
+}
+
+type Analysis struct {
+	gorm.Model
+	UserID       uint `gorm:"index"`
+	User         User
+	JobID        string         `gorm:"index"`
+	URL          string         `gorm:"index"`
+	Status       AnalysisStatus `gorm:"index;default:queued"`
+	Mode         CaptureMode    `gorm:"default:segmented"`
+	Error        string
+	Provider     string
+	LLMModel     string
+	Summary      string `gorm:"type:text"`
+	HTML         string `gorm:"type:text"`
+	InputTokens  int
+	OutputTokens int
+	Screenshots  []Screenshot `gorm:"constraint:OnDelete:CASCADE"`
+	Insights     []Insight    `gorm:"constraint:OnDelete:CASCADE"`
+}
+
+type Screenshot struct {
+	gorm.Model
+	AnalysisID uint `gorm:"index"`
+	Position   int
+	Device     string // name of the device profile the screenshot was taken with
+	OffsetY    int    // distance of the top of the screenshot from the top of the page, in CSS pixels
+	Width      int
+	Height     int
+	Format     string
+	Bytes      int
+	URL        string // public URL of screenshots stored before objects were private, cleared by cmd/privatize-screenshots
+	ObjectName string `gorm:"index"` // path of the object in the storage bucket, signed URLs are generated from it
+	// Elements are the DOM elements visible in the screenshot, for reviewing markup and visuals together
+	Elements []ScreenshotElement `gorm:"serializer:json;type:jsonb"`
+	// HiddenElements are the fixed and sticky elements hidden because an earlier screenshot shows them
+	HiddenElements []HiddenElement `gorm:"serializer:json;type:jsonb"`
+	// Step is the scripted step a screenshot was taken at, empty for captures of the whole page
+	Step string
+}
+
+// ScreenshotElement is the sanitized markup of an element shown in a
+// screenshot, its box is in screenshot pixels and clipped to the screenshot
+type ScreenshotElement struct {
+	Tag    string  `json:"tag"`
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+	HTML   string  `json:"html"`
+}
+
+// HiddenElement is a fixed or sticky element left out of a screenshot
+type HiddenElement struct {
+	Selector string `json:"selector"`
+	Position string `json:"position"`
+}
+
+type Insight struct {
+	gorm.Model
+	AnalysisID      uint   `gorm:"index"`
+	Category        string `gorm:"index"`
+	Severity        string `gorm:"index"`
+	Title           string
+	Description     string `gorm:"type:text"`
+	ScreenshotIndex int
+	BoxX            *float64
+	BoxY            *float64
+	BoxWidth        *float64
+	BoxHeight       *float64
+	RecommendedFix  string `gorm:"type:text"`
+}
+
+// UpdateAnalysisStatus moves the analysis to the next status, rejecting
+// transitions that skip or go back a stage
+func UpdateAnalysisStatus(db *gorm.DB, analysis *Analysis, next AnalysisStatus, reason string) error {
+	if !analysis.Status.CanTransitionTo(next) {
+		return fmt.Errorf("invalid analysis status transition from %s to %s", analysis.Status, next)
+	}
+
+	result := db.Model(analysis).Where("status = ?", analysis.Status).Updates(map[string]interface{}{
+		"status": next,
+		"error":  reason,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("analysis %d is no longer %s", analysis.ID, analysis.Status)
+	}
+
+	analysis.Status = next
+	analysis.Error = reason
+	return nil
+}
@@ -6,6 +6,18 @@ import (
 	"gorm.io/gorm"
 )
 
+// Plan is the subscription a user is on, it decides how long their screenshots are kept
+type Plan string
+
+const (
+	PlanFree       Plan = "free"
+	PlanPro        Plan = "pro"
+	PlanEnterprise Plan = "enterprise"
+)
+
+// Plans lists every plan
+var Plans = []Plan{PlanFree, PlanPro, PlanEnterprise}
+
 type User struct {
 	gorm.Model
 	Username      string `gorm:"index:,unique,where:username <> ''"` // Unique if not empty
@@ -16,6 +28,7 @@ type User struct {
 	ProviderID    string
 	AvatarURL     string
 	VerifiedEmail bool
+	Plan          Plan `gorm:"index;default:free"`
 }
 
 type Server struct {
@@ -0,0 +1,136 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// cancelRetention is how long a cancel request is remembered for a job that has not started yet
+const cancelRetention = 24 * time.Hour
+
+// Canceller delivers cancel requests to running jobs, regardless of which
+// process received the request and which one runs the job
+type Canceller interface {
+	Cancel(ctx context.Context, jobID string) error
+	// Context returns a copy of parent that is cancelled once the job is, also
+	// when that happened before the job started. release must be called when the job ends.
+	Context(parent context.Context, jobID string) (ctx context.Context, release func())
+}
+
+// NewCanceller uses Redis when a client is given so that cancel requests
+// reach the workers, otherwise they stay inside this process
+func NewCanceller(redisClient *redis.Client) Canceller {
+	if redisClient != nil {
+		return NewRedisCanceller(redisClient)
+	}
+	return NewMemoryCanceller()
+}
+
+// MemoryCanceller cancels jobs running in the same process
+type MemoryCanceller struct {
+	lock      sync.Mutex
+	running   map[string]context.CancelFunc
+	cancelled map[string]*time.Timer
+}
+
+func NewMemoryCanceller() *MemoryCanceller {
+	return &MemoryCanceller{
+		running:   make(map[string]context.CancelFunc),
+		cancelled: make(map[string]*time.Timer),
+	}
+}
+
+func (c *MemoryCanceller) Cancel(ctx context.Context, jobID string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if cancel, ok := c.running[jobID]; ok {
+		cancel()
+		return nil
+	}
+	if _, ok := c.cancelled[jobID]; !ok {
+		c.cancelled[jobID] = time.AfterFunc(cancelRetention, func() {
+			c.lock.Lock()
+			defer c.lock.Unlock()
+			delete(c.cancelled, jobID)
+		})
+	}
+	return nil
+}
+
+func (c *MemoryCanceller) Context(parent context.Context, jobID string) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(parent)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if timer, ok := c.cancelled[jobID]; ok {
+		timer.Stop()
+		delete(c.cancelled, jobID)
+		cancel()
+	}
+	c.running[jobID] = cancel
+
+	return ctx, func() {
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		delete(c.running, jobID)
+		cancel()
+	}
+}
+
+// RedisCanceller records cancel requests in Redis and announces them through
+// pub/sub to the worker running the job
+type RedisCanceller struct {
+	redis *redis.Client
+}
+
+func NewRedisCanceller(client *redis.Client) *RedisCanceller {
+	return &RedisCanceller{redis: client}
+}
+
+func cancelKey(jobID string) string {
+	return "insightify:jobs:" + jobID + ":cancelled"
+}
+
+func cancelChannel(jobID string) string {
+	return "insightify:jobs:" + jobID + ":cancel"
+}
+
+func (c *RedisCanceller) Cancel(ctx context.Context, jobID string) error {
+	pipe := c.redis.TxPipeline()
+	pipe.Set(ctx, cancelKey(jobID), 1, cancelRetention)
+	pipe.Publish(ctx, cancelChannel(jobID), 1)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (c *RedisCanceller) Context(parent context.Context, jobID string) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(parent)
+
+	// Subscribe before checking the key so a request made in between is not missed
+	pubsub := c.redis.Subscribe(ctx, cancelChannel(jobID))
+	if _, err := pubsub.Receive(ctx); err != nil {
+		log.Printf("Error watching job %s for cancellation: %v", jobID, err)
+		pubsub.Close()
+		return ctx, cancel
+	}
+
+	go func() {
+		defer pubsub.Close()
+		select {
+		case <-pubsub.Channel():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if exists, err := c.redis.Exists(ctx, cancelKey(jobID)).Result(); err == nil && exists > 0 {
+		cancel()
+	}
+
+	return ctx, cancel
+}
@@ -0,0 +1,170 @@
+package jobs
+
+import (
+	"Insightify-backend/internal/analyze/devices"
+	"Insightify-backend/internal/analyze/flow"
+	"Insightify-backend/internal/analyze/imaging"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	captureStream = "insightify:capture-jobs"
+	captureGroup  = "capture-workers"
+	// staleJobAge is how long a job may go without a heartbeat before another worker takes it over
+	staleJobAge = 15 * time.Minute
+	// heartbeatInterval is how often a consumer marks the job it runs as alive
+	heartbeatInterval = staleJobAge / 5
+)
+
+// CaptureJob is a queued request to capture and analyze a page
+type CaptureJob struct {
+	ID         string            `json:"id"`
+	AnalysisID uint              `json:"analysisId"`
+	UserID     uint              `json:"userId"`
+	URL        string            `json:"url"`
+	Provider   string            `json:"provider,omitempty"`
+	Model      string            `json:"model,omitempty"`
+	Devices    []devices.Profile `json:"devices,omitempty"`
+	Image      imaging.Options   `json:"image"`
+	// KeepBanners skips dismissing consent banners and modals
+	KeepBanners bool `json:"keepBanners,omitempty"`
+	// Steps are run on the page before it is captured
+	Steps []flow.Step `json:"steps,omitempty"`
+	// Session is the capture's session sealed with the shared CAPTURE_SECRETS_KEY, empty for anonymous captures
+	Session    string    `json:"session,omitempty"`
+	EnqueuedAt time.Time `json:"enqueuedAt"`
+}
+
+// Delivery is a job handed to a consumer, it must be acknowledged once handled
+type Delivery struct {
+	Job       CaptureJob
+	messageID string
+	consumer  string
+}
+
+// Queue stores capture jobs in a Redis stream consumed through a consumer group
+type Queue struct {
+	redis *redis.Client
+}
+
+func NewQueue(client *redis.Client) *Queue {
+	return &Queue{redis: client}
+}
+
+func NewJobID() string {
+	return uuid.NewString()
+}
+
+func (q *Queue) Enqueue(ctx context.Context, job CaptureJob) error {
+	if job.ID == "" {
+		job.ID = NewJobID()
+	}
+	job.EnqueuedAt = time.Now().UTC()
+
+	payload, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("error marshaling job: %v", err)
+	}
+
+	return q.redis.XAdd(ctx, &redis.XAddArgs{
+		Stream: captureStream,
+		Values: map[string]interface{}{"job": payload},
+	}).Err()
+}
+
+// EnsureGroup creates the stream and consumer group if they do not exist yet
+func (q *Queue) EnsureGroup(ctx context.Context) error {
+	err := q.redis.XGroupCreateMkStream(ctx, captureStream, captureGroup, "0").Err()
+	if err != nil && !strings.Contains(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	return nil
+}
+
+// Next blocks up to block for a job, first reclaiming jobs abandoned by crashed
+// consumers. It returns nil when no job is available.
+func (q *Queue) Next(ctx context.Context, consumer string, block time.Duration) (*Delivery, error) {
+	claimed, _, err := q.redis.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   captureStream,
+		Group:    captureGroup,
+		MinIdle:  staleJobAge,
+		Start:    "0",
+		Count:    1,
+		Consumer: consumer,
+	}).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+	if len(claimed) > 0 {
+		return q.toDelivery(ctx, claimed[0], consumer)
+	}
+
+	streams, err := q.redis.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    captureGroup,
+		Consumer: consumer,
+		Streams:  []string{captureStream, ">"},
+		Count:    1,
+		Block:    block,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, stream := range streams {
+		for _, message := range stream.Messages {
+			return q.toDelivery(ctx, message, consumer)
+		}
+	}
+	return nil, nil
+}
+
+// Heartbeat resets the idle time of a job that is still running, so it is not
+// reclaimed as abandoned however long the capture takes
+func (q *Queue) Heartbeat(ctx context.Context, delivery *Delivery) error {
+	return q.redis.XClaimJustID(ctx, &redis.XClaimArgs{
+		Stream:   captureStream,
+		Group:    captureGroup,
+		Consumer: delivery.consumer,
+		MinIdle:  0,
+		Messages: []string{delivery.messageID},
+	}).Err()
+}
+
+// Ack marks the job as handled and removes it from the stream, so payloads
+// such as sealed sessions are not kept once the job is done
+func (q *Queue) Ack(ctx context.Context, delivery *Delivery) error {
+	return q.remove(ctx, delivery.messageID)
+}
+
+func (q *Queue) remove(ctx context.Context, messageID string) error {
+	_, err := q.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAck(ctx, captureStream, captureGroup, messageID)
+		pipe.XDel(ctx, captureStream, messageID)
+		return nil
+	})
+	return err
+}
+
+// toDelivery decodes a stream message, malformed messages are acknowledged and dropped
+func (q *Queue) toDelivery(ctx context.Context, message redis.XMessage, consumer string) (*Delivery, error) {
+	payload, _ := message.Values["job"].(string)
+
+	var job CaptureJob
+	if err := json.Unmarshal([]byte(payload), &job); err != nil {
+		q.remove(ctx, message.ID)
+		return nil, fmt.Errorf("dropping malformed job %s: %v", message.ID, err)
+	}
+
+	return &Delivery{Job: job, messageID: message.ID, consumer: consumer}, nil
+}
@@ -0,0 +1,110 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+const pollInterval = 5 * time.Second
+
+// Handler processes a single capture job
+type Handler func(ctx context.Context, job CaptureJob) error
+
+// Worker consumes capture jobs from the queue with a fixed number of concurrent handlers
+type Worker struct {
+	queue       *Queue
+	concurrency int
+	handler     Handler
+}
+
+func NewWorker(queue *Queue, concurrency int, handler Handler) *Worker {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &Worker{
+		queue:       queue,
+		concurrency: concurrency,
+		handler:     handler,
+	}
+}
+
+// Run consumes jobs until ctx is cancelled, then waits for in-flight jobs to finish
+func (w *Worker) Run(ctx context.Context) error {
+	if err := w.queue.EnsureGroup(ctx); err != nil {
+		return fmt.Errorf("error creating consumer group: %v", err)
+	}
+
+	hostname, _ := os.Hostname()
+	var wg sync.WaitGroup
+	for i := 0; i < w.concurrency; i++ {
+		wg.Add(1)
+		consumer := fmt.Sprintf("%s-%d-%d", hostname, os.Getpid(), i)
+		go func() {
+			defer wg.Done()
+			w.consume(ctx, consumer)
+		}()
+	}
+
+	log.Printf("Worker started with %d consumers", w.concurrency)
+	wg.Wait()
+	return nil
+}
+
+func (w *Worker) consume(ctx context.Context, consumer string) {
+	for ctx.Err() == nil {
+		delivery, err := w.queue.Next(ctx, consumer, pollInterval)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("Error reading job queue: %v", err)
+			time.Sleep(time.Second)
+			continue
+		}
+		if delivery == nil {
+			continue
+		}
+
+		log.Printf("Consumer %s started job %s for %s", consumer, delivery.Job.ID, delivery.Job.URL)
+		// A job that has started is allowed to finish when the worker shuts down
+		stopHeartbeat := w.heartbeat(context.WithoutCancel(ctx), delivery)
+		if err := w.handler(context.WithoutCancel(ctx), delivery.Job); err != nil {
+			log.Printf("Job %s failed: %v", delivery.Job.ID, err)
+		}
+		stopHeartbeat()
+
+		// Failures are recorded on the analysis, so the job is not retried
+		if err := w.queue.Ack(context.WithoutCancel(ctx), delivery); err != nil {
+			log.Printf("Error acknowledging job %s: %v", delivery.Job.ID, err)
+		}
+	}
+}
+
+// heartbeat keeps the delivery claimed by this consumer until the returned function is called
+func (w *Worker) heartbeat(ctx context.Context, delivery *Delivery) func() {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(heartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := w.queue.Heartbeat(ctx, delivery); err != nil && ctx.Err() == nil {
+					log.Printf("Error sending heartbeat for job %s: %v", delivery.Job.ID, err)
+				}
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
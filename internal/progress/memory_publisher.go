@@ -0,0 +1,130 @@
+package progress
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+)
+
+// subscriberBuffer is how many messages a slow subscriber may fall behind before updates are dropped
+const subscriberBuffer = 256
+
+type jobLog struct {
+	events      [][]byte
+	subscribers map[chan []byte]struct{}
+	expires     *time.Timer
+	// written is when the last event was logged
+	written time.Time
+}
+
+// MemoryPublisher keeps job event logs and delivers progress to subscribers in the same process
+type MemoryPublisher struct {
+	lock sync.Mutex
+	jobs map[string]*jobLog
+}
+
+func NewMemoryPublisher() *MemoryPublisher {
+	return &MemoryPublisher{
+		jobs: make(map[string]*jobLog),
+	}
+}
+
+// job returns the log of the job, creating it when needed. The caller must hold the lock.
+func (p *MemoryPublisher) job(jobID string) *jobLog {
+	job, ok := p.jobs[jobID]
+	if !ok {
+		job = &jobLog{subscribers: make(map[chan []byte]struct{})}
+		p.jobs[jobID] = job
+	}
+	return job
+}
+
+func (p *MemoryPublisher) Publish(ctx context.Context, jobID string, msg Message) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	job := p.job(jobID)
+	msg.JobID = jobID
+	msg.Seq = int64(len(job.events)) + 1
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	job.events = append(job.events, payload)
+	job.written = time.Now()
+	p.expireAfter(jobID, job, logRetention)
+
+	for ch := range job.subscribers {
+		select {
+		case ch <- payload:
+		default:
+			log.Printf("Dropping progress message for slow subscriber of job %s", jobID)
+		}
+	}
+	return nil
+}
+
+func (p *MemoryPublisher) Subscribe(ctx context.Context, jobID string, since int64) (*Subscription, error) {
+	p.lock.Lock()
+	job := p.job(jobID)
+
+	// Replay and registration happen under the lock so no event is missed or repeated
+	var replay [][]byte
+	if since < int64(len(job.events)) {
+		replay = job.events[max(since, 0):]
+	}
+	ch := make(chan []byte, len(replay)+subscriberBuffer)
+	for _, payload := range replay {
+		ch <- payload
+	}
+	job.subscribers[ch] = struct{}{}
+	p.lock.Unlock()
+
+	var once sync.Once
+	done := make(chan struct{})
+	unsubscribe := func() {
+		once.Do(func() {
+			close(done)
+			p.lock.Lock()
+			defer p.lock.Unlock()
+			delete(job.subscribers, ch)
+			close(ch)
+			if len(job.subscribers) > 0 || p.jobs[jobID] != job {
+				return
+			}
+			if len(job.events) == 0 {
+				delete(p.jobs, jobID)
+				return
+			}
+			// The expiry may have passed while the log was still being followed
+			p.expireAfter(jobID, job, logRetention-time.Since(job.written))
+		})
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			unsubscribe()
+		case <-done:
+		}
+	}()
+
+	return &Subscription{messages: ch, close: unsubscribe}, nil
+}
+
+// expireAfter drops the log of the job once it has not been written to for
+// after, unless it is still followed then. The caller must hold the lock.
+func (p *MemoryPublisher) expireAfter(jobID string, job *jobLog, after time.Duration) {
+	if job.expires != nil {
+		job.expires.Stop()
+	}
+	job.expires = time.AfterFunc(max(after, 0), func() {
+		p.lock.Lock()
+		defer p.lock.Unlock()
+		if p.jobs[jobID] == job && len(job.subscribers) == 0 {
+			delete(p.jobs, jobID)
+		}
+	})
+}
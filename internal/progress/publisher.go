@@ -0,0 +1,53 @@
+package progress
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Message is a single progress update of a job, as sent to WebSocket clients.
+// JobID and Seq are assigned by the publisher, Seq starts at 1 and increases
+// by one for every message of the job.
+type Message struct {
+	Type    string      `json:"type"`
+	JobID   string      `json:"jobId,omitempty"`
+	Seq     int64       `json:"seq,omitempty"`
+	Content interface{} `json:"content"`
+}
+
+// logRetention is how long the event log of a job is kept for replay
+const logRetention = 24 * time.Hour
+
+// Publisher records the progress of every job in an event log and fans it
+// out to subscribers, regardless of which process produced it
+type Publisher interface {
+	Publish(ctx context.Context, jobID string, msg Message) error
+	// Subscribe returns the encoded messages of the job with a sequence number
+	// greater than since: first the ones already logged, then live ones. The
+	// channel is closed when ctx is cancelled or the subscription is closed.
+	Subscribe(ctx context.Context, jobID string, since int64) (*Subscription, error)
+}
+
+type Subscription struct {
+	messages <-chan []byte
+	close    func()
+}
+
+func (s *Subscription) Messages() <-chan []byte {
+	return s.messages
+}
+
+func (s *Subscription) Close() {
+	s.close()
+}
+
+// NewPublisher uses Redis pub/sub when a client is given so that workers and
+// API replicas share progress, otherwise updates stay inside this process
+func NewPublisher(redisClient *redis.Client) Publisher {
+	if redisClient != nil {
+		return NewRedisPublisher(redisClient)
+	}
+	return NewMemoryPublisher()
+}
@@ -0,0 +1,133 @@
+package progress
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisPublisher keeps job event logs in Redis lists and relays live progress
+// through pub/sub, so that the worker running a job and the API replica
+// holding the socket can differ
+type RedisPublisher struct {
+	redis *redis.Client
+}
+
+func NewRedisPublisher(client *redis.Client) *RedisPublisher {
+	return &RedisPublisher{redis: client}
+}
+
+func channelName(jobID string) string {
+	return "insightify:jobs:" + jobID + ":progress"
+}
+
+func eventsKey(jobID string) string {
+	return "insightify:jobs:" + jobID + ":events"
+}
+
+func seqKey(jobID string) string {
+	return "insightify:jobs:" + jobID + ":seq"
+}
+
+// publishScript numbers, logs and publishes an event in one step, so events
+// of concurrent publishers are logged and published in sequence order. The
+// sequence number is spliced in as the first field of the marshaled message.
+var publishScript = redis.NewScript(`
+local seq = redis.call('INCR', KEYS[1])
+local payload = '{"seq":' .. seq .. ',' .. string.sub(ARGV[1], 2)
+redis.call('RPUSH', KEYS[2], payload)
+redis.call('EXPIRE', KEYS[1], ARGV[2])
+redis.call('EXPIRE', KEYS[2], ARGV[2])
+redis.call('PUBLISH', KEYS[3], payload)
+return seq
+`)
+
+func (p *RedisPublisher) Publish(ctx context.Context, jobID string, msg Message) error {
+	msg.JobID = jobID
+	msg.Seq = 0
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	keys := []string{seqKey(jobID), eventsKey(jobID), channelName(jobID)}
+	return publishScript.Run(ctx, p.redis, keys, payload, int64(logRetention/time.Second)).Err()
+}
+
+func (p *RedisPublisher) Subscribe(ctx context.Context, jobID string, since int64) (*Subscription, error) {
+	pubsub := p.redis.Subscribe(ctx, channelName(jobID))
+	// Wait for the subscription to be confirmed so nothing published afterwards is missed
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+
+	// Events are pushed in sequence order, so the list index of seq n is n-1
+	logged, err := p.redis.LRange(ctx, eventsKey(jobID), max(since, 0), -1).Result()
+	if err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+
+	ch := make(chan []byte, len(logged)+subscriberBuffer)
+	lastSeq := since
+	for _, payload := range logged {
+		ch <- []byte(payload)
+		lastSeq = max(lastSeq, messageSeq([]byte(payload)))
+	}
+
+	done := make(chan struct{})
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			close(done)
+			pubsub.Close()
+		})
+	}
+
+	go func() {
+		defer close(ch)
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				unsubscribe()
+				return
+			case <-done:
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				// Skip what was already replayed from the log
+				payload := []byte(msg.Payload)
+				seq := messageSeq(payload)
+				if seq <= lastSeq {
+					continue
+				}
+				lastSeq = seq
+				select {
+				case ch <- payload:
+				case <-done:
+					return
+				case <-ctx.Done():
+					unsubscribe()
+					return
+				}
+			}
+		}
+	}()
+
+	return &Subscription{messages: ch, close: unsubscribe}, nil
+}
+
+func messageSeq(payload []byte) int64 {
+	var msg struct {
+		Seq int64 `json:"seq"`
+	}
+	_ = json.Unmarshal(payload, &msg)
+	return msg.Seq
+}
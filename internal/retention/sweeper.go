@@ -0,0 +1,230 @@
+package retention
+
+import (
+	"Insightify-backend/internal/blobstore"
+	"Insightify-backend/internal/database/models"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	day = 24 * time.Hour
+	// batchSize is how many screenshots or objects are handled per database query
+	batchSize = 200
+	// defaultOrphanMaxDeletes caps the objects one orphan scan deletes
+	defaultOrphanMaxDeletes = 1000
+)
+
+// errLimitReached stops an orphan scan that has deleted OrphanMaxDeletes objects
+var errLimitReached = errors.New("orphan scan limit reached")
+
+// defaultRetention is how long screenshots are kept on each plan
+var defaultRetention = map[models.Plan]time.Duration{
+	models.PlanFree:       7 * day,
+	models.PlanPro:        30 * day,
+	models.PlanEnterprise: 365 * day,
+}
+
+// Config controls what the sweeper removes and how often it runs
+type Config struct {
+	// Retention is how long screenshots are kept after their analysis was created, per plan
+	Retention map[models.Plan]time.Duration
+	// SweepInterval is how often expired screenshots are removed
+	SweepInterval time.Duration
+	// OrphanScanInterval is how often the blob store is scanned for objects no screenshot refers to
+	OrphanScanInterval time.Duration
+	// OrphanGracePeriod protects recent objects, a capture records its screenshots after uploading them
+	OrphanGracePeriod time.Duration
+	// OrphanMaxDeletes stops a scan once it has deleted that many objects, the next scan continues. Zero means no limit.
+	OrphanMaxDeletes int
+	// OrphanDryRun logs the objects a scan would delete instead of deleting them
+	OrphanDryRun bool
+}
+
+// ConfigFromEnv reads RETENTION_DAYS_FREE, RETENTION_DAYS_PRO and
+// RETENTION_DAYS_ENTERPRISE, RETENTION_SWEEP_INTERVAL, ORPHAN_SCAN_INTERVAL
+// and ORPHAN_GRACE_PERIOD (durations such as 6h), ORPHAN_MAX_DELETES and
+// ORPHAN_DRY_RUN, keeping the defaults for missing or invalid values
+func ConfigFromEnv() Config {
+	config := Config{
+		Retention:          make(map[models.Plan]time.Duration, len(defaultRetention)),
+		SweepInterval:      time.Hour,
+		OrphanScanInterval: day,
+		OrphanGracePeriod:  day,
+		OrphanMaxDeletes:   defaultOrphanMaxDeletes,
+	}
+	for plan, retention := range defaultRetention {
+		config.Retention[plan] = retention
+		if days, err := strconv.Atoi(os.Getenv("RETENTION_DAYS_" + strings.ToUpper(string(plan)))); err == nil && days > 0 {
+			config.Retention[plan] = time.Duration(days) * day
+		}
+	}
+	durationFromEnv("RETENTION_SWEEP_INTERVAL", &config.SweepInterval)
+	durationFromEnv("ORPHAN_SCAN_INTERVAL", &config.OrphanScanInterval)
+	durationFromEnv("ORPHAN_GRACE_PERIOD", &config.OrphanGracePeriod)
+	if maxDeletes, err := strconv.Atoi(os.Getenv("ORPHAN_MAX_DELETES")); err == nil && maxDeletes > 0 {
+		config.OrphanMaxDeletes = maxDeletes
+	}
+	config.OrphanDryRun, _ = strconv.ParseBool(os.Getenv("ORPHAN_DRY_RUN"))
+	return config
+}
+
+func durationFromEnv(name string, value *time.Duration) {
+	if parsed, err := time.ParseDuration(os.Getenv(name)); err == nil && parsed > 0 {
+		*value = parsed
+	}
+}
+
+// Screenshots looks up and removes screenshot rows, it is implemented by
+// services.AnalysisService
+type Screenshots interface {
+	ExpiredScreenshots(ctx context.Context, plan models.Plan, before time.Time, limit int) ([]models.Screenshot, error)
+	DeleteScreenshots(ctx context.Context, ids []uint) error
+	ReferencedObjects(ctx context.Context, objectNames []string) (map[string]bool, error)
+	UnreferencedObjects(ctx context.Context, objectNames []string) ([]string, error)
+}
+
+// Sweeper deletes screenshots that are past their plan's retention and
+// objects in the blob store that no screenshot refers to. Running it on
+// several processes is safe, deleting an object twice is not an error.
+type Sweeper struct {
+	analyses Screenshots
+	blobs    blobstore.BlobStore
+	config   Config
+}
+
+func NewSweeper(analyses Screenshots, blobs blobstore.BlobStore, config Config) *Sweeper {
+	return &Sweeper{analyses: analyses, blobs: blobs, config: config}
+}
+
+// Run sweeps on the configured intervals until ctx is cancelled
+func (s *Sweeper) Run(ctx context.Context) {
+	sweep := time.NewTicker(s.config.SweepInterval)
+	defer sweep.Stop()
+	scan := time.NewTicker(s.config.OrphanScanInterval)
+	defer scan.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sweep.C:
+			deleted, err := s.SweepExpired(ctx, time.Now())
+			if err != nil {
+				log.Printf("Error sweeping expired screenshots: %v", err)
+			}
+			if deleted > 0 {
+				log.Printf("Deleted %d expired screenshots", deleted)
+			}
+		case <-scan.C:
+			deleted, err := s.DeleteOrphans(ctx, time.Now())
+			if err != nil {
+				log.Printf("Error scanning for orphaned objects: %v", err)
+			}
+			if deleted > 0 {
+				log.Printf("Deleted %d orphaned objects", deleted)
+			}
+		}
+	}
+}
+
+// SweepExpired removes the screenshots of every plan that are older than its
+// retention together with the objects no other screenshot shares. Objects
+// whose removal fails are left to the orphan scan.
+func (s *Sweeper) SweepExpired(ctx context.Context, now time.Time) (int, error) {
+	deleted := 0
+	for plan, retention := range s.config.Retention {
+		for {
+			screenshots, err := s.analyses.ExpiredScreenshots(ctx, plan, now.Add(-retention), batchSize)
+			if err != nil {
+				return deleted, fmt.Errorf("error loading expired screenshots: %v", err)
+			}
+			if len(screenshots) == 0 {
+				break
+			}
+
+			ids := make([]uint, 0, len(screenshots))
+			objectNames := make([]string, 0, len(screenshots))
+			for _, screenshot := range screenshots {
+				ids = append(ids, screenshot.ID)
+				if screenshot.ObjectName != "" {
+					objectNames = append(objectNames, screenshot.ObjectName)
+				}
+			}
+			if err := s.analyses.DeleteScreenshots(ctx, ids); err != nil {
+				return deleted, fmt.Errorf("error deleting screenshot rows: %v", err)
+			}
+			deleted += len(screenshots)
+
+			// Objects still shared with newer screenshots are kept
+			unreferenced, err := s.analyses.UnreferencedObjects(ctx, objectNames)
+			if err != nil {
+				return deleted, fmt.Errorf("error looking up screenshots: %v", err)
+			}
+			if err := blobstore.DeleteAll(ctx, s.blobs, unreferenced); err != nil {
+				return deleted, err
+			}
+
+			if len(screenshots) < batchSize {
+				break
+			}
+		}
+	}
+	return deleted, nil
+}
+
+// DeleteOrphans removes objects under the screenshot prefix that are older
+// than the grace period and that no screenshot refers to, at most
+// OrphanMaxDeletes of them. It returns how many objects it deleted, or would
+// have deleted in a dry run.
+func (s *Sweeper) DeleteOrphans(ctx context.Context, now time.Time) (int, error) {
+	deleted := 0
+	var batch []string
+	flush := func() error {
+		referenced, err := s.analyses.ReferencedObjects(ctx, batch)
+		if err != nil {
+			return fmt.Errorf("error looking up screenshots: %v", err)
+		}
+		for _, key := range batch {
+			if referenced[key] {
+				continue
+			}
+			if s.config.OrphanMaxDeletes > 0 && deleted >= s.config.OrphanMaxDeletes {
+				return errLimitReached
+			}
+			if s.config.OrphanDryRun {
+				log.Printf("Orphan scan dry run, would delete %s", key)
+			} else if err := s.blobs.Delete(ctx, key); err != nil {
+				return fmt.Errorf("failed to delete %s: %v", key, err)
+			}
+			deleted++
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	err := s.blobs.List(ctx, blobstore.ScreenshotPrefix, func(object blobstore.Object) error {
+		if now.Sub(object.Modified) < s.config.OrphanGracePeriod {
+			return nil
+		}
+		batch = append(batch, object.Key)
+		if len(batch) < batchSize {
+			return nil
+		}
+		return flush()
+	})
+	if err == nil && len(batch) > 0 {
+		err = flush()
+	}
+	if errors.Is(err, errLimitReached) {
+		log.Printf("Orphan scan stopped after %d objects, the next scan continues", deleted)
+		err = nil
+	}
+	return deleted, err
+}
@@ -2,6 +2,7 @@ package server
 
 import (
 	"Insightify-backend/internal/analyze"
+	"Insightify-backend/internal/blobstore"
 	tokenvalidation "Insightify-backend/internal/validateToken"
 	"encoding/json"
 	"log"
@@ -26,7 +27,7 @@ func (s *Server) RegisterRoutes() http.Handler {
 	r.Use(corsHandler)
 
 	r.Use(middleware.Logger)
-	r.With(tokenvalidation.TokenAuthMiddleware).Mount("/analysis", analyze.AnalysisRoutes())
+	r.With(tokenvalidation.TokenAuthMiddleware).Mount("/analysis", analyze.AnalysisRoutes(analyze.NewAnalysisHandler(s.analysisService, s.userService, s.progress, s.queue, s.cancels, s.browsers, s.blobs)))
 	r.Mount("/", s.generalRoutes())
 
 	return r
@@ -35,7 +36,12 @@ func (s *Server) RegisterRoutes() http.Handler {
 func (s *Server) generalRoutes() chi.Router {
 	r := chi.NewRouter()
 	r.Get("/", s.HelloWorldHandler)
+	// Blobs on the local disk are served by the API itself
+	if store, ok := s.blobs.(*blobstore.LocalStore); ok {
+		r.Handle("/blobs/*", http.StripPrefix("/blobs", store.Handler()))
+	}
 	r.With(tokenvalidation.TokenAuthMiddleware).Get("/health", s.healthHandler)
+	r.With(tokenvalidation.TokenAuthMiddleware).Get("/browser/stats", s.browserStatsHandler)
 	return r
 }
 
@@ -57,3 +63,15 @@ func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	_, _ = w.Write(jsonResp)
 }
+
+// browserStatsHandler reports the state of the browser pool, it is not found when captures run on workers
+func (s *Server) browserStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if s.browsers == nil {
+		http.Error(w, "Captures run on workers", http.StatusNotFound)
+		return
+	}
+
+	jsonResp, _ := json.Marshal(s.browsers.Stats())
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(jsonResp)
+}
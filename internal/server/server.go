@@ -1,9 +1,17 @@
 package server
 
 import (
+	"Insightify-backend/internal/blobstore"
+	"Insightify-backend/internal/browser"
 	"Insightify-backend/internal/database"
+	"Insightify-backend/internal/jobs"
+	"Insightify-backend/internal/progress"
+	"Insightify-backend/internal/retention"
 	"Insightify-backend/internal/services"
+	"Insightify-backend/internal/utils"
+	"context"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
 	"strconv"
@@ -12,10 +20,20 @@ import (
 	_ "github.com/joho/godotenv/autoload"
 )
 
+// defaultBrowserPoolSize is the number of browsers kept warm when captures run inside the API process
+const defaultBrowserPoolSize = 2
+
 type Server struct {
-	port        int
-	dbService   database.Service
-	userService *services.UserService
+	port            int
+	dbService       database.Service
+	userService     *services.UserService
+	analysisService *services.AnalysisService
+	progress        progress.Publisher
+	queue           *jobs.Queue
+	cancels         jobs.Canceller
+	// browsers is nil when captures run on workers
+	browsers *browser.Pool
+	blobs    blobstore.BlobStore
 }
 
 func NewServer() *http.Server {
@@ -31,12 +49,39 @@ func NewServer() *http.Server {
 
 	// Pass the GORM DB from the database service to the UserService
 	userService := services.NewUserService(dbService.DB())
+	analysisService := services.NewAnalysisService(dbService.DB())
+
+	// Captures are queued for cmd/worker and progress is shared between
+	// replicas when Redis is configured
+	redisClient := utils.NewRedisClient(context.Background())
+	var queue *jobs.Queue
+	var browsers *browser.Pool
+	if redisClient != nil {
+		queue = jobs.NewQueue(redisClient)
+	} else {
+		browsers = browser.NewPool(browser.ConfigFromEnv(defaultBrowserPoolSize))
+	}
+
+	blobs, err := blobstore.New(context.Background())
+	if err != nil {
+		log.Fatalf("error creating blob store: %v", err)
+	}
+	// Without workers the API process sweeps expired screenshots itself
+	if queue == nil {
+		go retention.NewSweeper(analysisService, blobs, retention.ConfigFromEnv()).Run(context.Background())
+	}
 
 	// Create the server struct
 	server := &Server{
-		port:        port,
-		dbService:   dbService,
-		userService: userService,
+		port:            port,
+		dbService:       dbService,
+		userService:     userService,
+		analysisService: analysisService,
+		progress:        progress.NewPublisher(redisClient),
+		queue:           queue,
+		cancels:         jobs.NewCanceller(redisClient),
+		browsers:        browsers,
+		blobs:           blobs,
 	}
 
 	// Configure the HTTP server
@@ -0,0 +1,287 @@
+package services
+
+import (
+	"Insightify-backend/internal/analyze/insights"
+	"Insightify-backend/internal/analyze/llm"
+	"Insightify-backend/internal/database/models"
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type AnalysisService struct {
+	db *gorm.DB
+}
+
+func NewAnalysisService(db *gorm.DB) *AnalysisService {
+	return &AnalysisService{db: db}
+}
+
+func (s *AnalysisService) CreateAnalysis(ctx context.Context, userID uint, jobID string, url string, mode models.CaptureMode, provider llm.LLMProvider) (*models.Analysis, error) {
+	analysis := models.Analysis{
+		UserID:   userID,
+		JobID:    jobID,
+		URL:      url,
+		Status:   models.AnalysisStatusQueued,
+		Mode:     mode,
+		Provider: provider.Name(),
+		LLMModel: provider.Model(),
+	}
+	if err := s.db.WithContext(ctx).Create(&analysis).Error; err != nil {
+		return nil, err
+	}
+	return &analysis, nil
+}
+
+func (s *AnalysisService) UpdateStatus(ctx context.Context, analysis *models.Analysis, status models.AnalysisStatus) error {
+	return models.UpdateAnalysisStatus(s.db.WithContext(ctx), analysis, status, "")
+}
+
+// FailAnalysis marks the analysis as failed with the reason shown to the user
+func (s *AnalysisService) FailAnalysis(ctx context.Context, analysis *models.Analysis, reason string) error {
+	return models.UpdateAnalysisStatus(s.db.WithContext(ctx), analysis, models.AnalysisStatusFailed, reason)
+}
+
+// CancelAnalysis marks the analysis as cancelled by the user and drops the
+// screenshots recorded so far, whose objects the caller has removed
+func (s *AnalysisService) CancelAnalysis(ctx context.Context, analysis *models.Analysis) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("analysis_id = ?", analysis.ID).Delete(&models.Screenshot{}).Error; err != nil {
+			return err
+		}
+		return models.UpdateAnalysisStatus(tx, analysis, models.AnalysisStatusCancelled, "")
+	})
+}
+
+func (s *AnalysisService) AddScreenshot(ctx context.Context, screenshot *models.Screenshot) error {
+	return s.db.WithContext(ctx).Create(screenshot).Error
+}
+
+func (s *AnalysisService) SaveHTML(ctx context.Context, analysis *models.Analysis, html string) error {
+	analysis.HTML = html
+	return s.db.WithContext(ctx).Model(analysis).Update("html", html).Error
+}
+
+// CompleteAnalysis stores the insight report and marks the analysis as done in one transaction
+func (s *AnalysisService) CompleteAnalysis(ctx context.Context, analysis *models.Analysis, report *insights.Report, usage llm.Usage) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		rows := make([]models.Insight, 0, len(report.Insights))
+		for _, insight := range report.Insights {
+			row := models.Insight{
+				AnalysisID:      analysis.ID,
+				Category:        insight.Category,
+				Severity:        insight.Severity,
+				Title:           insight.Title,
+				Description:     insight.Description,
+				ScreenshotIndex: insight.ScreenshotIndex,
+				RecommendedFix:  insight.RecommendedFix,
+			}
+			if box := insight.BoundingBox; box != nil {
+				row.BoxX, row.BoxY, row.BoxWidth, row.BoxHeight = &box.X, &box.Y, &box.Width, &box.Height
+			}
+			rows = append(rows, row)
+		}
+		if len(rows) > 0 {
+			if err := tx.Create(&rows).Error; err != nil {
+				return err
+			}
+		}
+
+		err := tx.Model(analysis).Updates(map[string]interface{}{
+			"summary":       report.Summary,
+			"input_tokens":  usage.InputTokens,
+			"output_tokens": usage.OutputTokens,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		return models.UpdateAnalysisStatus(tx, analysis, models.AnalysisStatusDone, "")
+	})
+}
+
+// likeEscaper escapes the wildcards of LIKE patterns, so filters match literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// AnalysisFilter narrows the analysis history of a user
+type AnalysisFilter struct {
+	URL      string
+	Status   models.AnalysisStatus
+	From     *time.Time
+	To       *time.Time
+	Page     int
+	PageSize int
+}
+
+func (s *AnalysisService) ListAnalyses(ctx context.Context, userID uint, filter AnalysisFilter) ([]models.Analysis, int64, error) {
+	query := s.db.WithContext(ctx).Model(&models.Analysis{}).Where("user_id = ?", userID)
+	if filter.URL != "" {
+		query = query.Where(`url ILIKE ? ESCAPE '\'`, "%"+likeEscaper.Replace(filter.URL)+"%")
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at < ?", *filter.To)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var analyses []models.Analysis
+	err := query.Order("created_at DESC").
+		Offset((filter.Page - 1) * filter.PageSize).
+		Limit(filter.PageSize).
+		Find(&analyses).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return analyses, total, nil
+}
+
+// GetAnalysis loads an analysis of the user with its screenshots and insights,
+// returning nil when it does not exist or belongs to someone else
+func (s *AnalysisService) GetAnalysis(ctx context.Context, userID uint, id uint) (*models.Analysis, error) {
+	var analysis models.Analysis
+	err := s.db.WithContext(ctx).
+		Preload("Screenshots", func(db *gorm.DB) *gorm.DB { return db.Order("position") }).
+		Preload("Insights").
+		Where("id = ? AND user_id = ?", id, userID).
+		First(&analysis).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &analysis, nil
+}
+
+// GetAnalysisByJobID returns the user's analysis created for the job, or nil when there is none
+func (s *AnalysisService) GetAnalysisByJobID(ctx context.Context, userID uint, jobID string) (*models.Analysis, error) {
+	var analysis models.Analysis
+	err := s.db.WithContext(ctx).Where("job_id = ? AND user_id = ?", jobID, userID).First(&analysis).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &analysis, nil
+}
+
+// DeleteAnalysis permanently removes the analysis together with its screenshot and insight rows
+func (s *AnalysisService) DeleteAnalysis(ctx context.Context, analysis *models.Analysis) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("analysis_id = ?", analysis.ID).Delete(&models.Screenshot{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("analysis_id = ?", analysis.ID).Delete(&models.Insight{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(analysis).Error
+	})
+}
+
+// GetAnalysisByID loads an analysis regardless of its owner, for use by background jobs
+func (s *AnalysisService) GetAnalysisByID(ctx context.Context, id uint) (*models.Analysis, error) {
+	var analysis models.Analysis
+	if err := s.db.WithContext(ctx).First(&analysis, id).Error; err != nil {
+		return nil, err
+	}
+	return &analysis, nil
+}
+
+// ExpiredScreenshots returns up to limit screenshots of finished analyses
+// created before the given time by users on the plan
+func (s *AnalysisService) ExpiredScreenshots(ctx context.Context, plan models.Plan, before time.Time, limit int) ([]models.Screenshot, error) {
+	var screenshots []models.Screenshot
+	err := s.db.WithContext(ctx).
+		Joins("JOIN analyses ON analyses.id = screenshots.analysis_id").
+		Joins("JOIN users ON users.id = analyses.user_id").
+		Where("users.plan = ? AND analyses.created_at < ?", plan, before).
+		Where("analyses.status IN ?", []models.AnalysisStatus{models.AnalysisStatusDone, models.AnalysisStatusFailed, models.AnalysisStatusCancelled}).
+		Order("screenshots.id").
+		Limit(limit).
+		Find(&screenshots).Error
+	return screenshots, err
+}
+
+// DeleteScreenshots permanently removes screenshot rows whose objects the caller has removed
+func (s *AnalysisService) DeleteScreenshots(ctx context.Context, ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return s.db.WithContext(ctx).Unscoped().Delete(&models.Screenshot{}, ids).Error
+}
+
+// PublicScreenshots returns up to limit screenshots after the given ID that
+// still have the public URL they were stored with before objects were private
+func (s *AnalysisService) PublicScreenshots(ctx context.Context, afterID uint, limit int) ([]models.Screenshot, error) {
+	var screenshots []models.Screenshot
+	err := s.db.WithContext(ctx).
+		Where("url <> '' AND id > ?", afterID).
+		Order("id").
+		Limit(limit).
+		Find(&screenshots).Error
+	return screenshots, err
+}
+
+// MakeScreenshotPrivate replaces the public URL of a screenshot with the name
+// of its object, which signed URLs are generated from
+func (s *AnalysisService) MakeScreenshotPrivate(ctx context.Context, screenshot *models.Screenshot, objectName string) error {
+	screenshot.URL = ""
+	screenshot.ObjectName = objectName
+	return s.db.WithContext(ctx).Model(screenshot).Updates(map[string]interface{}{"url": "", "object_name": objectName}).Error
+}
+
+// ReferencedObjects reports which of the object names belong to a screenshot.
+// Objects are content addressed and shared by every screenshot with the same
+// image, so they may only be removed once no screenshot refers to them.
+func (s *AnalysisService) ReferencedObjects(ctx context.Context, objectNames []string) (map[string]bool, error) {
+	var referenced []string
+	err := s.db.WithContext(ctx).Model(&models.Screenshot{}).
+		Where("object_name IN ?", objectNames).
+		Distinct().
+		Pluck("object_name", &referenced).Error
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]bool, len(referenced))
+	for _, objectName := range referenced {
+		result[objectName] = true
+	}
+	return result, nil
+}
+
+// UnreferencedObjects returns the object names no screenshot refers to any
+// more, for removal after screenshot rows were deleted
+func (s *AnalysisService) UnreferencedObjects(ctx context.Context, objectNames []string) ([]string, error) {
+	if len(objectNames) == 0 {
+		return nil, nil
+	}
+	referenced, err := s.ReferencedObjects(ctx, objectNames)
+	if err != nil {
+		return nil, err
+	}
+
+	var unreferenced []string
+	seen := make(map[string]bool, len(objectNames))
+	for _, objectName := range objectNames {
+		if referenced[objectName] || seen[objectName] {
+			continue
+		}
+		seen[objectName] = true
+		unreferenced = append(unreferenced, objectName)
+	}
+	return unreferenced, nil
+}
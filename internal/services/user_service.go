@@ -36,3 +36,25 @@ func (s *UserService) CreateUserOrUpdate(ctx context.Context, user models.User)
 	}
 	return &user, nil
 }
+
+// GetOrCreateByProviderID returns the user linked to the identity provider account,
+// creating it on first sight
+func (s *UserService) GetOrCreateByProviderID(ctx context.Context, provider string, providerID string, email string) (*models.User, error) {
+	var user models.User
+	err := s.db.WithContext(ctx).Where("provider_id = ? AND provider = ?", providerID, provider).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		user = models.User{
+			Provider:   provider,
+			ProviderID: providerID,
+			Email:      email,
+		}
+		if err := s.db.WithContext(ctx).Create(&user).Error; err != nil {
+			return nil, err
+		}
+		return &user, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
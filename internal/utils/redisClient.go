@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"context"
+	"log"
+	"os"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// NewRedisClient connects to REDIS_URL, it returns nil when Redis is not configured
+func NewRedisClient(ctx context.Context) *redis.Client {
+	redisURL := os.Getenv("REDIS_URL")
+	if redisURL == "" {
+		return nil
+	}
+
+	opt, err := redis.ParseURL(redisURL)
+	if err != nil {
+		log.Fatalf("Failed to parse REDIS_URL: %v", err)
+	}
+
+	client := redis.NewClient(opt)
+	if err := client.Ping(ctx).Err(); err != nil {
+		log.Fatalf("error connecting to Redis: %v", err)
+	}
+
+	return client
+}
@@ -1,6 +1,7 @@
 package tokenvalidation
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"os"
@@ -28,29 +29,46 @@ func TokenAuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		err := validateToken(tokenString)
+		claims, err := validateToken(tokenString)
 		if err != nil {
 			http.Error(w, fmt.Sprintf("Unauthorized: %v", err), http.StatusUnauthorized)
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		ctx := context.WithValue(r.Context(), claimsContextKey, claims)
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+type contextKey string
+
+const claimsContextKey contextKey = "claims"
+
+// Claims are the identity details of the authenticated caller
+type Claims struct {
+	Subject string
+	Email   string
+}
+
+// ClaimsFromContext returns the claims stored by TokenAuthMiddleware
+func ClaimsFromContext(ctx context.Context) (Claims, bool) {
+	claims, ok := ctx.Value(claimsContextKey).(Claims)
+	return claims, ok
+}
+
 // validateToken verifies the provided JWT token without checking the audience
-func validateToken(tokenString string) error {
+func validateToken(tokenString string) (Claims, error) {
 	tokenIssuer := os.Getenv("KINDE_ENVIRONMENT_DOMAIN")
 
 	if tokenIssuer == "" {
-		return fmt.Errorf("missing environment variable KINDE_ENVIRONMENT_DOMAIN")
+		return Claims{}, fmt.Errorf("missing environment variable KINDE_ENVIRONMENT_DOMAIN")
 	}
 
 	jwksURL := fmt.Sprintf("%v/.well-known/jwks", tokenIssuer)
 	jwks, err := keyfunc.Get(jwksURL, keyfunc.Options{})
 	if err != nil {
 		fmt.Println("unauthorized1: ", err)
-		return fmt.Errorf("unauthorized: %v", err)
+		return Claims{}, fmt.Errorf("unauthorized: %v", err)
 	}
 
 	parsedToken, err := jwt.Parse(tokenString, jwks.Keyfunc,
@@ -58,14 +76,24 @@ func validateToken(tokenString string) error {
 		jwt.WithIssuer(tokenIssuer))             // verifying the token issuer
 	if err != nil {
 		fmt.Println("unauthorized2: ", err)
-		return fmt.Errorf("unauthorized: %v", err)
+		return Claims{}, fmt.Errorf("unauthorized: %v", err)
 	}
 
 	// Check if token is valid
 	if !parsedToken.Valid {
 		fmt.Println("unauthorized3: ", err)
-		return fmt.Errorf("unauthorized: invalid token")
+		return Claims{}, fmt.Errorf("unauthorized: invalid token")
+	}
+
+	subject, err := parsedToken.Claims.GetSubject()
+	if err != nil || subject == "" {
+		return Claims{}, fmt.Errorf("unauthorized: token has no subject")
+	}
+
+	claims := Claims{Subject: subject}
+	if mapClaims, ok := parsedToken.Claims.(jwt.MapClaims); ok {
+		claims.Email, _ = mapClaims["email"].(string)
 	}
 
-	return nil
+	return claims, nil
 }
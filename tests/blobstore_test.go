@@ -0,0 +1,87 @@
+package tests
+
+import (
+	"Insightify-backend/internal/blobstore"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalStore(t *testing.T) {
+	ctx := context.Background()
+	store, err := blobstore.NewLocalStore(t.TempDir(), "http://localhost:8080/blobs/", []byte("secret"))
+	if err != nil {
+		t.Fatalf("error creating store. Err: %v", err)
+	}
+
+	if err := store.Put(ctx, "2024-05-01/screenshot 1.webp", []byte("image"), "image/webp"); err != nil {
+		t.Fatalf("error storing blob. Err: %v", err)
+	}
+	data, err := store.Get(ctx, "2024-05-01/screenshot 1.webp")
+	if err != nil {
+		t.Fatalf("error reading blob. Err: %v", err)
+	}
+	stored, err := store.Exists(ctx, "2024-05-01/screenshot 1.webp")
+	if err != nil {
+		t.Fatalf("error looking up blob. Err: %v", err)
+	}
+	signed, err := store.SignedURL(ctx, "2024-05-01/screenshot 1.webp", time.Minute)
+	if err != nil {
+		t.Fatalf("error signing URL. Err: %v", err)
+	}
+	expired, err := store.SignedURL(ctx, "2024-05-01/screenshot 1.webp", -time.Minute)
+	if err != nil {
+		t.Fatalf("error signing URL. Err: %v", err)
+	}
+	signedStatus := serveBlob(t, store, signed)
+	expiredStatus := serveBlob(t, store, expired)
+	unsignedStatus := serveBlob(t, store, "http://localhost:8080/blobs/2024-05-01/screenshot%201.webp")
+	if err := blobstore.DeleteAll(ctx, store, []string{"2024-05-01/screenshot 1.webp", "missing.webp"}); err != nil {
+		t.Fatalf("error deleting blobs. Err: %v", err)
+	}
+	_, missingErr := store.Get(ctx, "2024-05-01/screenshot 1.webp")
+	storedAfterDelete, err := store.Exists(ctx, "2024-05-01/screenshot 1.webp")
+	if err != nil {
+		t.Fatalf("error looking up blob. Err: %v", err)
+	}
+	invalidErr := store.Put(ctx, "../outside.webp", []byte("image"), "image/webp")
+
+	// Assertions
+	if string(data) != "image" {
+		t.Errorf("expected stored data to be %q; got %q", "image", data)
+	}
+	if !strings.HasPrefix(signed, "http://localhost:8080/blobs/2024-05-01/screenshot%201.webp?") {
+		t.Errorf("expected escaped blob URL; got %v", signed)
+	}
+	if signedStatus != http.StatusOK {
+		t.Errorf("expected signed URL to be served; got status %v", signedStatus)
+	}
+	if expiredStatus != http.StatusForbidden || unsignedStatus != http.StatusForbidden {
+		t.Errorf("expected expired and unsigned URLs to be forbidden; got status %v and %v", expiredStatus, unsignedStatus)
+	}
+	if !stored || storedAfterDelete {
+		t.Errorf("expected blob to exist until deleted; got %v before and %v after", stored, storedAfterDelete)
+	}
+	if !errors.Is(missingErr, blobstore.ErrNotFound) {
+		t.Errorf("expected deleted blob to be not found; got %v", missingErr)
+	}
+	if invalidErr == nil {
+		t.Errorf("expected key outside the storage directory to be rejected")
+	}
+}
+
+// serveBlob requests the blob URL from the store's handler mounted under /blobs
+func serveBlob(t *testing.T, store *blobstore.LocalStore, blobURL string) int {
+	parsed, err := url.Parse(blobURL)
+	if err != nil {
+		t.Fatalf("error parsing URL. Err: %v", err)
+	}
+	recorder := httptest.NewRecorder()
+	http.StripPrefix("/blobs", store.Handler()).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, parsed.RequestURI(), nil))
+	return recorder.Code
+}
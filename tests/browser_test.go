@@ -0,0 +1,25 @@
+package tests
+
+import (
+	"Insightify-backend/internal/browser"
+	"testing"
+)
+
+func TestBrowserConfigFromEnv(t *testing.T) {
+	t.Setenv("BROWSER_POOL_SIZE", "")
+	t.Setenv("BROWSER_MAX_JOBS", "invalid")
+	t.Setenv("CHROME_REMOTE_URLS", "ws://chrome-1:9222, ,ws://chrome-2:9222")
+
+	config := browser.ConfigFromEnv(3)
+
+	// Assertions
+	if config.Size != 3 {
+		t.Errorf("expected size to be %v; got %v", 3, config.Size)
+	}
+	if config.MaxJobs != 50 {
+		t.Errorf("expected max jobs to fall back to %v; got %v", 50, config.MaxJobs)
+	}
+	if len(config.RemoteURLs) != 2 || config.RemoteURLs[1] != "ws://chrome-2:9222" {
+		t.Errorf("expected two remote URLs; got %v", config.RemoteURLs)
+	}
+}
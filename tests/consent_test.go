@@ -0,0 +1,37 @@
+package tests
+
+import (
+	"Insightify-backend/internal/analyze/consent"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadConsentRules(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "rules.json")
+	invalid := filepath.Join(dir, "invalid.json")
+	if err := os.WriteFile(valid, []byte(`[
+		{"name": "shop", "domains": ["shop.example"], "banner": "#privacy-layer", "accept": "#privacy-layer .ok"},
+		{"name": "keep", "domains": ["news.example"], "skip": true}
+	]`), 0o644); err != nil {
+		t.Fatalf("error writing rules. Err: %v", err)
+	}
+	if err := os.WriteFile(invalid, []byte(`[{"name": "everywhere", "banner": "#banner"}]`), 0o644); err != nil {
+		t.Fatalf("error writing rules. Err: %v", err)
+	}
+
+	rules, err := consent.LoadRules(valid)
+	if err != nil {
+		t.Fatalf("error loading rules. Err: %v", err)
+	}
+	_, invalidErr := consent.LoadRules(invalid)
+
+	// Assertions
+	if len(rules) != 2 || rules[0].Accept != "#privacy-layer .ok" || !rules[1].Skip {
+		t.Errorf("expected the two rules of the file; got %+v", rules)
+	}
+	if invalidErr == nil {
+		t.Errorf("expected a rule without domains to be rejected")
+	}
+}
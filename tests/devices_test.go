@@ -0,0 +1,34 @@
+package tests
+
+import (
+	"Insightify-backend/internal/analyze/devices"
+	"testing"
+)
+
+func TestResolveDevices(t *testing.T) {
+	profiles, err := devices.Resolve([]devices.Profile{
+		{Name: "mobile"},
+		{Name: "kiosk", Width: 1080, Height: 1920},
+	})
+	if err != nil {
+		t.Fatalf("error resolving device profiles. Err: %v", err)
+	}
+
+	// Assertions
+	if len(profiles) != 2 {
+		t.Fatalf("expected 2 profiles; got %v", len(profiles))
+	}
+	if !profiles[0].Mobile || profiles[0].Width == 0 {
+		t.Errorf("expected the built-in mobile profile; got %+v", profiles[0])
+	}
+	if profiles[1].DeviceScaleFactor != 1 || profiles[1].UserAgent == "" {
+		t.Errorf("expected defaults to be filled in for the custom profile; got %+v", profiles[1])
+	}
+
+	if _, err := devices.Resolve([]devices.Profile{{Name: "watch"}}); err == nil {
+		t.Errorf("expected an error for an unknown profile")
+	}
+	if _, err := devices.Resolve([]devices.Profile{{Name: "tiny", Width: 100, Height: 100}}); err == nil {
+		t.Errorf("expected an error for a custom profile below the minimum size")
+	}
+}
@@ -0,0 +1,39 @@
+package tests
+
+import (
+	"Insightify-backend/internal/analyze/flow"
+	"strings"
+	"testing"
+)
+
+func TestValidateSteps(t *testing.T) {
+	valid := []flow.Step{
+		{Action: flow.ActionClick, Selector: "#menu-toggle"},
+		{Action: flow.ActionType, Selector: "#email", Value: "user@example.com"},
+		{Action: flow.ActionWaitForNetworkIdle, Timeout: 5000},
+		{Action: flow.ActionScreenshot, Name: "menu open"},
+	}
+	missingSelector := []flow.Step{
+		{Action: flow.ActionScroll, Y: 400},
+		{Action: flow.ActionHover},
+	}
+	unknownAction := []flow.Step{{Action: "drag", Selector: "#slider"}}
+
+	validErr := flow.Validate(valid)
+	missingErr := flow.Validate(missingSelector)
+	unknownErr := flow.Validate(unknownAction)
+
+	// Assertions
+	if validErr != nil {
+		t.Errorf("expected the steps to be valid; got %v", validErr)
+	}
+	if missingErr == nil || !strings.HasPrefix(missingErr.Error(), "step 2 (hover)") {
+		t.Errorf("expected the error to name step 2; got %v", missingErr)
+	}
+	if unknownErr == nil {
+		t.Errorf("expected an unknown action to be rejected")
+	}
+	if description := valid[1].String(); strings.Contains(description, "user@example.com") {
+		t.Errorf("expected the typed value to be left out of the description; got %v", description)
+	}
+}
@@ -0,0 +1,96 @@
+package tests
+
+import (
+	"Insightify-backend/internal/analyze/imaging"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func solidTile(t *testing.T, width, height int, c color.Color, offsetY int) imaging.Tile {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	data, err := imaging.EncodePNG(img)
+	if err != nil {
+		t.Fatalf("error encoding tile. Err: %v", err)
+	}
+	return imaging.Tile{Image: data, OffsetY: offsetY}
+}
+
+func TestStitch(t *testing.T) {
+	red := color.RGBA{R: 255, A: 255}
+	blue := color.RGBA{B: 255, A: 255}
+
+	// The second tile overlaps the first by 4 pixels, as the last scroll of a page does
+	stitched, err := imaging.Stitch([]imaging.Tile{
+		solidTile(t, 8, 10, red, 0),
+		solidTile(t, 8, 10, blue, 6),
+	}, 16)
+	if err != nil {
+		t.Fatalf("error stitching tiles. Err: %v", err)
+	}
+
+	// Assertions
+	if stitched.Bounds().Dx() != 8 || stitched.Bounds().Dy() != 16 {
+		t.Errorf("expected a 8x16 image; got %v", stitched.Bounds())
+	}
+	if got := stitched.RGBAAt(0, 5); got != red {
+		t.Errorf("expected pixel above the overlap to be %v; got %v", red, got)
+	}
+	if got := stitched.RGBAAt(0, 6); got != blue {
+		t.Errorf("expected the overlap to be drawn by the later tile %v; got %v", blue, got)
+	}
+}
+
+func TestEncodeTallWebP(t *testing.T) {
+	// Taller than the 16383 pixels WebP can encode, as full page captures of long pages are
+	tile := solidTile(t, 400, 17000, color.RGBA{G: 255, A: 255}, 0)
+
+	encoded, err := imaging.Encode(tile.Image, imaging.Options{Format: imaging.FormatWebP, Quality: 80})
+	if err != nil {
+		t.Fatalf("error encoding image. Err: %v", err)
+	}
+
+	// Assertions
+	if encoded.Format != imaging.FormatWebP {
+		t.Errorf("expected image to be encoded as %v; got %v", imaging.FormatWebP, encoded.Format)
+	}
+	if encoded.Height > 16383 || encoded.Height < 16000 {
+		t.Errorf("expected image to be downscaled to at most 16383 pixels tall; got %v", encoded.Height)
+	}
+	if ratio := float64(encoded.Height) / float64(encoded.Width); ratio < 42 || ratio > 43 {
+		t.Errorf("expected image to keep its aspect ratio; got %vx%v", encoded.Width, encoded.Height)
+	}
+}
+
+func TestEncodeWithinBudget(t *testing.T) {
+	// Noise compresses badly, so the budget can only be met by downscaling
+	img := image.NewRGBA(image.Rect(0, 0, 1200, 800))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i * 7919 % 251)
+	}
+	data, err := imaging.EncodePNG(img)
+	if err != nil {
+		t.Fatalf("error encoding source image. Err: %v", err)
+	}
+
+	encoded, err := imaging.Encode(data, imaging.Options{Format: imaging.FormatJPEG, Quality: 90, MaxBytes: 100000})
+	if err != nil {
+		t.Fatalf("error encoding image. Err: %v", err)
+	}
+
+	// Assertions
+	if !encoded.WithinBudget || len(encoded.Data) > 100000 {
+		t.Errorf("expected image to fit the budget of %v bytes; got %v", 100000, len(encoded.Data))
+	}
+	if ratio := float64(encoded.Width) / float64(encoded.Height); encoded.Width >= 1200 || ratio < 1.49 || ratio > 1.51 {
+		t.Errorf("expected image to be downscaled keeping its aspect ratio; got %vx%v", encoded.Width, encoded.Height)
+	}
+	if encoded.Format.ContentType() != "image/jpeg" {
+		t.Errorf("expected content type to be %v; got %v", "image/jpeg", encoded.Format.ContentType())
+	}
+}
@@ -0,0 +1,39 @@
+package tests
+
+import (
+	"Insightify-backend/internal/analyze/insights"
+	"errors"
+	"testing"
+)
+
+func TestParseInsightReport(t *testing.T) {
+	text := "```json\n" + `{"summary":"Clean layout","insights":[{"category":"accessibility","severity":"high","title":"Low contrast","description":"Grey text on white","screenshotIndex":1,"boundingBox":{"x":10,"y":20,"width":300,"height":40},"recommendedFix":"Darken the text"}]}` + "\n```"
+
+	report, err := insights.Parse(text, 2)
+	if err != nil {
+		t.Fatalf("error parsing report. Err: %v", err)
+	}
+
+	// Assertions
+	if len(report.Insights) != 1 {
+		t.Fatalf("expected 1 insight; got %v", len(report.Insights))
+	}
+	if report.Insights[0].BoundingBox == nil || report.Insights[0].BoundingBox.Width != 300 {
+		t.Errorf("expected bounding box width to be 300; got %v", report.Insights[0].BoundingBox)
+	}
+}
+
+func TestParseInsightReportSchemaViolation(t *testing.T) {
+	text := `{"summary":"","insights":[{"category":"vibes","severity":"high","title":"Title","description":"Desc","screenshotIndex":3,"boundingBox":null,"recommendedFix":""}]}`
+
+	_, err := insights.Parse(text, 2)
+
+	// Assertions
+	var validationErr *insights.ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected validation error; got %v", err)
+	}
+	if len(validationErr.Problems) != 2 {
+		t.Errorf("expected 2 problems; got %v", validationErr.Problems)
+	}
+}
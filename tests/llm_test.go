@@ -0,0 +1,99 @@
+package tests
+
+import (
+	"Insightify-backend/internal/analyze/llm"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLocalProvider(t *testing.T) {
+	var received map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("expected request to /v1/chat/completions; got %v", r.URL.Path)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Fatalf("error decoding request body. Err: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"Looks good"}}]}`))
+	}))
+	defer server.Close()
+
+	t.Setenv("LOCAL_LLM_BASE_URL", server.URL+"/v1")
+	provider, err := llm.NewProvider(llm.ProviderLocal, "test-model")
+	if err != nil {
+		t.Fatalf("error creating provider. Err: %v", err)
+	}
+
+	resp, err := provider.Complete(context.Background(), llm.Request{
+		Messages: []llm.Message{
+			{Role: llm.RoleUser, Parts: []llm.Part{llm.TextPart("Review"), llm.ImagePart("https://example.com/a.png")}},
+		},
+		MaxTokens: 100,
+	})
+	if err != nil {
+		t.Fatalf("error completing request. Err: %v", err)
+	}
+
+	// Assertions
+	if resp.Text != "Looks good" {
+		t.Errorf("expected response text to be %v; got %v", "Looks good", resp.Text)
+	}
+	if received["model"] != "test-model" {
+		t.Errorf("expected model to be %v; got %v", "test-model", received["model"])
+	}
+	messages := received["messages"].([]interface{})
+	content := messages[0].(map[string]interface{})["content"].([]interface{})
+	image := content[1].(map[string]interface{})
+	if image["type"] != "image_url" {
+		t.Errorf("expected second content to be image_url; got %v", image["type"])
+	}
+}
+
+func TestUnknownProvider(t *testing.T) {
+	if _, err := llm.NewProvider("unknown", ""); err == nil {
+		t.Errorf("expected error for unknown provider")
+	}
+}
+
+func TestLocalProviderStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"Looks \"}}]}\n\n"))
+		_, _ = w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"good\"}}]}\n\n"))
+		_, _ = w.Write([]byte("data: {\"choices\":[],\"usage\":{\"prompt_tokens\":10,\"completion_tokens\":2,\"total_tokens\":12}}\n\n"))
+		_, _ = w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer server.Close()
+
+	t.Setenv("LOCAL_LLM_BASE_URL", server.URL)
+	provider, err := llm.NewProvider(llm.ProviderLocal, "test-model")
+	if err != nil {
+		t.Fatalf("error creating provider. Err: %v", err)
+	}
+
+	var deltas []string
+	resp, err := provider.Stream(context.Background(), llm.Request{
+		Messages: []llm.Message{{Role: llm.RoleUser, Parts: []llm.Part{llm.TextPart("Review")}}},
+	}, func(delta string) {
+		deltas = append(deltas, delta)
+	})
+	if err != nil {
+		t.Fatalf("error streaming request. Err: %v", err)
+	}
+
+	// Assertions
+	if len(deltas) != 2 {
+		t.Errorf("expected 2 deltas; got %v", len(deltas))
+	}
+	if resp.Text != "Looks good" {
+		t.Errorf("expected response text to be %v; got %v", "Looks good", resp.Text)
+	}
+	if resp.Usage.TotalTokens != 12 {
+		t.Errorf("expected total tokens to be 12; got %v", resp.Usage.TotalTokens)
+	}
+}
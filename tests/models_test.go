@@ -0,0 +1,33 @@
+package tests
+
+import (
+	"Insightify-backend/internal/database/models"
+	"testing"
+)
+
+func TestAnalysisStatusTransitions(t *testing.T) {
+	cases := []struct {
+		from     models.AnalysisStatus
+		to       models.AnalysisStatus
+		expected bool
+	}{
+		{models.AnalysisStatusQueued, models.AnalysisStatusCapturing, true},
+		{models.AnalysisStatusCapturing, models.AnalysisStatusAnalyzing, true},
+		{models.AnalysisStatusAnalyzing, models.AnalysisStatusDone, true},
+		{models.AnalysisStatusCapturing, models.AnalysisStatusFailed, true},
+		{models.AnalysisStatusAnalyzing, models.AnalysisStatusCancelled, true},
+		{models.AnalysisStatusQueued, models.AnalysisStatusDone, false},
+		{models.AnalysisStatusCancelled, models.AnalysisStatusCapturing, false},
+		{models.AnalysisStatusDone, models.AnalysisStatusFailed, false},
+		{models.AnalysisStatusFailed, models.AnalysisStatusCapturing, false},
+	}
+
+	for _, c := range cases {
+		if got := c.from.CanTransitionTo(c.to); got != c.expected {
+			t.Errorf("expected transition from %v to %v to be %v; got %v", c.from, c.to, c.expected, got)
+		}
+	}
+	if !models.AnalysisStatusCancelled.Valid() || models.AnalysisStatus("complete").Valid() {
+		t.Errorf("expected only known statuses to be valid")
+	}
+}
@@ -0,0 +1,82 @@
+package tests
+
+import (
+	"Insightify-backend/internal/progress"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestMemoryPublisher(t *testing.T) {
+	publisher := progress.NewMemoryPublisher()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	subscription, err := publisher.Subscribe(ctx, "job-1", 0)
+	if err != nil {
+		t.Fatalf("error subscribing. Err: %v", err)
+	}
+
+	_ = publisher.Publish(ctx, "job-2", progress.Message{Type: "status", Content: "other job"})
+	_ = publisher.Publish(ctx, "job-1", progress.Message{Type: "status", Content: "started"})
+
+	// Assertions
+	select {
+	case payload := <-subscription.Messages():
+		var msg progress.Message
+		if err := json.Unmarshal(payload, &msg); err != nil {
+			t.Fatalf("error decoding message. Err: %v", err)
+		}
+		if msg.Content != "started" {
+			t.Errorf("expected content to be %v; got %v", "started", msg.Content)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected a message for job-1")
+	}
+
+	cancel()
+	select {
+	case _, ok := <-subscription.Messages():
+		if ok {
+			t.Errorf("expected no further messages after cancel")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected subscription to be closed after cancel")
+	}
+}
+
+func TestMemoryPublisherReplay(t *testing.T) {
+	publisher := progress.NewMemoryPublisher()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for _, content := range []string{"received", "capturing", "analyzing"} {
+		_ = publisher.Publish(ctx, "job-1", progress.Message{Type: "status", Content: content})
+	}
+
+	subscription, err := publisher.Subscribe(ctx, "job-1", 1)
+	if err != nil {
+		t.Fatalf("error subscribing. Err: %v", err)
+	}
+	_ = publisher.Publish(ctx, "job-1", progress.Message{Type: "status", Content: "done"})
+
+	// Assertions
+	for _, expected := range []int64{2, 3, 4} {
+		select {
+		case payload := <-subscription.Messages():
+			var msg progress.Message
+			if err := json.Unmarshal(payload, &msg); err != nil {
+				t.Fatalf("error decoding message. Err: %v", err)
+			}
+			if msg.Seq != expected {
+				t.Errorf("expected seq to be %v; got %v", expected, msg.Seq)
+			}
+			if msg.JobID != "job-1" {
+				t.Errorf("expected jobId to be %v; got %v", "job-1", msg.JobID)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected message with seq %v", expected)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package tests
+
+import (
+	"Insightify-backend/internal/blobstore"
+	"Insightify-backend/internal/database/models"
+	"Insightify-backend/internal/retention"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestRetentionConfigFromEnv(t *testing.T) {
+	t.Setenv("RETENTION_DAYS_FREE", "")
+	t.Setenv("RETENTION_DAYS_PRO", "90")
+	t.Setenv("RETENTION_DAYS_ENTERPRISE", "-1")
+	t.Setenv("RETENTION_SWEEP_INTERVAL", "15m")
+	t.Setenv("ORPHAN_SCAN_INTERVAL", "invalid")
+
+	config := retention.ConfigFromEnv()
+
+	// Assertions
+	if config.Retention[models.PlanFree] != 7*24*time.Hour {
+		t.Errorf("expected free plan retention to be 7 days; got %v", config.Retention[models.PlanFree])
+	}
+	if config.Retention[models.PlanPro] != 90*24*time.Hour {
+		t.Errorf("expected pro plan retention to be 90 days; got %v", config.Retention[models.PlanPro])
+	}
+	if config.Retention[models.PlanEnterprise] != 365*24*time.Hour {
+		t.Errorf("expected enterprise plan retention to fall back to 365 days; got %v", config.Retention[models.PlanEnterprise])
+	}
+	if config.SweepInterval != 15*time.Minute {
+		t.Errorf("expected sweep interval to be %v; got %v", 15*time.Minute, config.SweepInterval)
+	}
+	if config.OrphanScanInterval != 24*time.Hour {
+		t.Errorf("expected orphan scan interval to fall back to %v; got %v", 24*time.Hour, config.OrphanScanInterval)
+	}
+}
+
+// fakeScreenshots keeps screenshot rows in memory
+type fakeScreenshots struct {
+	rows []models.Screenshot
+	// plans holds the plan of the owner of each screenshot by ID
+	plans map[uint]models.Plan
+	// created holds when the analysis of each screenshot was created by ID
+	created map[uint]time.Time
+}
+
+func (f *fakeScreenshots) ExpiredScreenshots(ctx context.Context, plan models.Plan, before time.Time, limit int) ([]models.Screenshot, error) {
+	var expired []models.Screenshot
+	for _, row := range f.rows {
+		if f.plans[row.ID] == plan && f.created[row.ID].Before(before) && len(expired) < limit {
+			expired = append(expired, row)
+		}
+	}
+	return expired, nil
+}
+
+func (f *fakeScreenshots) DeleteScreenshots(ctx context.Context, ids []uint) error {
+	deleted := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		deleted[id] = true
+	}
+	rows := f.rows[:0]
+	for _, row := range f.rows {
+		if !deleted[row.ID] {
+			rows = append(rows, row)
+		}
+	}
+	f.rows = rows
+	return nil
+}
+
+func (f *fakeScreenshots) ReferencedObjects(ctx context.Context, objectNames []string) (map[string]bool, error) {
+	referenced := make(map[string]bool)
+	for _, row := range f.rows {
+		for _, objectName := range objectNames {
+			if row.ObjectName == objectName {
+				referenced[objectName] = true
+			}
+		}
+	}
+	return referenced, nil
+}
+
+func (f *fakeScreenshots) UnreferencedObjects(ctx context.Context, objectNames []string) ([]string, error) {
+	referenced, _ := f.ReferencedObjects(ctx, objectNames)
+	var unreferenced []string
+	for _, objectName := range objectNames {
+		if !referenced[objectName] {
+			unreferenced = append(unreferenced, objectName)
+		}
+	}
+	return unreferenced, nil
+}
+
+func newRetentionStore(t *testing.T, keys ...string) (*blobstore.LocalStore, string) {
+	dir := t.TempDir()
+	store, err := blobstore.NewLocalStore(dir, "http://localhost:8080/blobs/", []byte("secret"))
+	if err != nil {
+		t.Fatalf("error creating store. Err: %v", err)
+	}
+	for _, key := range keys {
+		if err := store.Put(context.Background(), key, []byte("image"), "image/webp"); err != nil {
+			t.Fatalf("error storing blob. Err: %v", err)
+		}
+	}
+	return store, dir
+}
+
+func storedKeys(t *testing.T, store *blobstore.LocalStore) []string {
+	var keys []string
+	err := store.List(context.Background(), "", func(object blobstore.Object) error {
+		keys = append(keys, object.Key)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("error listing blobs. Err: %v", err)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestDeleteOrphansKeepsObjectsOutsideScreenshotPrefix(t *testing.T) {
+	store, dir := newRetentionStore(t,
+		"2024-05-01/baseline.png",
+		"exports/report.pdf",
+		"screenshots/orphan.webp",
+		"screenshots/referenced.webp",
+		"screenshots/recent.webp",
+	)
+	now := time.Now()
+	old := now.Add(-48 * time.Hour)
+	for _, key := range []string{"2024-05-01/baseline.png", "exports/report.pdf", "screenshots/orphan.webp", "screenshots/referenced.webp"} {
+		if err := os.Chtimes(filepath.Join(dir, filepath.FromSlash(key)), old, old); err != nil {
+			t.Fatalf("error ageing blob. Err: %v", err)
+		}
+	}
+	screenshots := &fakeScreenshots{rows: []models.Screenshot{{Model: gorm.Model{ID: 1}, ObjectName: "screenshots/referenced.webp"}}}
+	sweeper := retention.NewSweeper(screenshots, store, retention.Config{OrphanGracePeriod: 24 * time.Hour})
+
+	deleted, err := sweeper.DeleteOrphans(context.Background(), now)
+	if err != nil {
+		t.Fatalf("error deleting orphans. Err: %v", err)
+	}
+
+	// Assertions
+	if deleted != 1 {
+		t.Errorf("expected 1 deleted object; got %d", deleted)
+	}
+	expected := []string{"2024-05-01/baseline.png", "exports/report.pdf", "screenshots/recent.webp", "screenshots/referenced.webp"}
+	if keys := storedKeys(t, store); !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected remaining objects %v; got %v", expected, keys)
+	}
+}
+
+func TestDeleteOrphansLimitAndDryRun(t *testing.T) {
+	store, _ := newRetentionStore(t, "screenshots/a.webp", "screenshots/b.webp", "screenshots/c.webp")
+	later := time.Now().Add(48 * time.Hour)
+
+	dryRun := retention.NewSweeper(&fakeScreenshots{}, store, retention.Config{OrphanGracePeriod: time.Hour, OrphanDryRun: true})
+	wouldDelete, err := dryRun.DeleteOrphans(context.Background(), later)
+	if err != nil {
+		t.Fatalf("error running dry run. Err: %v", err)
+	}
+	dryRunKeys := storedKeys(t, store)
+
+	limited := retention.NewSweeper(&fakeScreenshots{}, store, retention.Config{OrphanGracePeriod: time.Hour, OrphanMaxDeletes: 2})
+	deleted, err := limited.DeleteOrphans(context.Background(), later)
+	if err != nil {
+		t.Fatalf("error deleting orphans. Err: %v", err)
+	}
+
+	// Assertions
+	if wouldDelete != 3 || len(dryRunKeys) != 3 {
+		t.Errorf("expected the dry run to count 3 objects and keep them; got %d counted and %v kept", wouldDelete, dryRunKeys)
+	}
+	if deleted != 2 {
+		t.Errorf("expected the scan to stop after 2 deletions; got %d", deleted)
+	}
+	if keys := storedKeys(t, store); len(keys) != 1 {
+		t.Errorf("expected 1 remaining object; got %v", keys)
+	}
+}
+
+func TestSweepExpiredKeepsSharedObjects(t *testing.T) {
+	store, _ := newRetentionStore(t, "screenshots/shared.webp", "screenshots/expired.webp")
+	now := time.Now()
+	screenshots := &fakeScreenshots{
+		rows: []models.Screenshot{
+			{Model: gorm.Model{ID: 1}, ObjectName: "screenshots/expired.webp"},
+			{Model: gorm.Model{ID: 2}, ObjectName: "screenshots/shared.webp"},
+			{Model: gorm.Model{ID: 3}, ObjectName: "screenshots/shared.webp"},
+		},
+		plans:   map[uint]models.Plan{1: models.PlanFree, 2: models.PlanFree, 3: models.PlanPro},
+		created: map[uint]time.Time{1: now.Add(-10 * 24 * time.Hour), 2: now.Add(-10 * 24 * time.Hour), 3: now.Add(-10 * 24 * time.Hour)},
+	}
+	config := retention.Config{Retention: map[models.Plan]time.Duration{models.PlanFree: 7 * 24 * time.Hour, models.PlanPro: 30 * 24 * time.Hour}}
+
+	deleted, err := retention.NewSweeper(screenshots, store, config).SweepExpired(context.Background(), now)
+	if err != nil {
+		t.Fatalf("error sweeping expired screenshots. Err: %v", err)
+	}
+
+	// Assertions
+	if deleted != 2 {
+		t.Errorf("expected 2 deleted screenshots; got %d", deleted)
+	}
+	if len(screenshots.rows) != 1 || screenshots.rows[0].ID != 3 {
+		t.Errorf("expected only the pro plan screenshot to remain; got %v", screenshots.rows)
+	}
+	expected := []string{"screenshots/shared.webp"}
+	if keys := storedKeys(t, store); !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected remaining objects %v; got %v", expected, keys)
+	}
+}
@@ -0,0 +1,63 @@
+package tests
+
+import (
+	"Insightify-backend/internal/analyze/session"
+	"bytes"
+	"testing"
+)
+
+func TestSealSession(t *testing.T) {
+	sealer, err := session.NewSealer(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatalf("error creating sealer. Err: %v", err)
+	}
+	other, err := session.NewSealer(bytes.Repeat([]byte{2}, 32))
+	if err != nil {
+		t.Fatalf("error creating sealer. Err: %v", err)
+	}
+	original := session.Session{
+		Cookies: []session.Cookie{{Name: "sid", Value: "secret-cookie"}},
+		Headers: map[string]string{"Authorization": "Bearer secret-token"},
+	}
+
+	sealed, err := sealer.Seal(original)
+	if err != nil {
+		t.Fatalf("error sealing session. Err: %v", err)
+	}
+	opened, err := sealer.Open(sealed)
+	if err != nil {
+		t.Fatalf("error opening session. Err: %v", err)
+	}
+	_, otherErr := other.Open(sealed)
+
+	// Assertions
+	if bytes.Contains([]byte(sealed), []byte("secret")) {
+		t.Errorf("expected the sealed session not to contain the secrets; got %v", sealed)
+	}
+	if len(opened.Cookies) != 1 || opened.Cookies[0].Value != "secret-cookie" || opened.Headers["Authorization"] != "Bearer secret-token" {
+		t.Errorf("expected the original session; got %+v", opened)
+	}
+	if otherErr == nil {
+		t.Errorf("expected a session sealed with another key not to open")
+	}
+}
+
+func TestValidateSession(t *testing.T) {
+	valid := session.Session{
+		Cookies: []session.Cookie{{Name: "sid", Value: "1", Domain: ".example.com", SameSite: "Lax"}},
+		Headers: map[string]string{"Authorization": "Basic dXNlcjpwYXNz"},
+	}
+	foreignCookie := session.Session{Cookies: []session.Cookie{{Name: "sid", Value: "1", Domain: "tracker.test"}}}
+	hostHeader := session.Session{Headers: map[string]string{"Host": "other.test"}}
+
+	// Assertions
+	if err := valid.Validate("https://app.example.com/dashboard"); err != nil {
+		t.Errorf("expected the session to be valid; got %v", err)
+	}
+	if err := foreignCookie.Validate("https://app.example.com/dashboard"); err == nil {
+		t.Errorf("expected a cookie for another domain to be rejected")
+	}
+	if err := hostHeader.Validate("https://app.example.com/dashboard"); err == nil {
+		t.Errorf("expected the Host header to be rejected")
+	}
+}
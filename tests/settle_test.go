@@ -0,0 +1,30 @@
+package tests
+
+import (
+	"Insightify-backend/internal/analyze/scraper"
+	"testing"
+	"time"
+)
+
+func TestSettleOptionsFromEnv(t *testing.T) {
+	t.Setenv("SETTLE_MAX_HEIGHT", "12000")
+	t.Setenv("SETTLE_MAX_ITEMS", "0")
+	t.Setenv("SETTLE_ITEM_SELECTOR", "")
+	t.Setenv("SETTLE_TIMEOUT", "invalid")
+
+	options := scraper.SettleOptionsFromEnv()
+
+	// Assertions
+	if options.MaxHeight != 12000 {
+		t.Errorf("expected max height to be %v; got %v", 12000, options.MaxHeight)
+	}
+	if options.MaxItems != 0 {
+		t.Errorf("expected the item limit to be disabled; got %v", options.MaxItems)
+	}
+	if options.ItemSelector == "" {
+		t.Errorf("expected the default item selector to be used")
+	}
+	if options.Timeout != 30*time.Second {
+		t.Errorf("expected timeout to fall back to %v; got %v", 30*time.Second, options.Timeout)
+	}
+}
@@ -0,0 +1,82 @@
+package tests
+
+import (
+	"Insightify-backend/internal/analyze/consent"
+	"Insightify-backend/internal/analyze/devices"
+	"Insightify-backend/internal/analyze/flow"
+	"Insightify-backend/internal/analyze/scraper"
+	"Insightify-backend/internal/database/models"
+	"Insightify-backend/internal/progress"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+const dialogPage = `<!DOCTYPE html>
+<html>
+<body>
+	<button id="open" onclick="document.getElementById('menu').hidden = false">Open</button>
+	<div id="menu" role="dialog" aria-modal="true" hidden>
+		<p>Menu</p>
+		<button aria-label="Close" onclick="document.getElementById('menu').hidden = true">×</button>
+	</div>
+	<div style="height: 3000px"></div>
+</body>
+</html>`
+
+// findChrome skips the test on machines without a Chrome or Chromium binary
+func findChrome(t *testing.T) string {
+	for _, name := range []string{"headless-shell", "chromium", "chromium-browser", "google-chrome", "google-chrome-stable"} {
+		if path, err := exec.LookPath(name); err == nil {
+			return path
+		}
+	}
+	t.Skip("Chrome is not installed")
+	return ""
+}
+
+func TestStepOpenedDialogSurvivesPreparation(t *testing.T) {
+	chrome := findChrome(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(dialogPage))
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	allocatorCtx, cancelAllocator := chromedp.NewExecAllocator(ctx, append(chromedp.DefaultExecAllocatorOptions[:], chromedp.ExecPath(chrome))...)
+	defer cancelAllocator()
+	browserCtx, cancelBrowser := chromedp.NewContext(allocatorCtx)
+	defer cancelBrowser()
+
+	profile := devices.Default()
+	if err := chromedp.Run(browserCtx, chromedp.EmulateViewport(profile.Width, profile.Height), chromedp.Navigate(server.URL)); err != nil {
+		t.Fatalf("error loading page. Err: %v", err)
+	}
+
+	s := &scraper.Scraper{
+		Progress: progress.NewMemoryPublisher(),
+		JobID:    "steps-test",
+		Consent:  consent.NewDismisser(nil, consent.ActionAccept),
+		Settle:   scraper.SettleOptionsFromEnv(),
+		Steps:    []flow.Step{{Action: flow.ActionClick, Selector: "#open"}},
+	}
+	if _, _, err := s.PreparePage(browserCtx, &models.Analysis{}, profile, 0); err != nil {
+		t.Fatalf("error preparing page. Err: %v", err)
+	}
+	var open bool
+	if err := chromedp.Run(browserCtx, chromedp.Evaluate(`document.getElementById('menu').getClientRects().length > 0`, &open)); err != nil {
+		t.Fatalf("error reading dialog state. Err: %v", err)
+	}
+
+	// Assertions
+	if !open {
+		t.Errorf("expected the dialog opened by the step to still be open at capture time")
+	}
+}